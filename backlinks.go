@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+Backlinks let us see which Headlines (in any outline) link to the current Headline or outline.
+
+The linkIndex records every link found in every .gv file beneath the storage directory.  It is built the first
+time backlinks are requested and kept up to date whenever an outline is saved (or deleted).  The links in each
+outline are kept in the outline cache (see cache.go), so building it only reads the outlines that have changed
+since they were cached.  The Organizer shows the backlinks as a list of entries which can be opened just like
+outlines.
+
+*/
+
+const backlinkSnippetLength = 40 // how much of the linking Headline's text to show
+
+// a link found in an outline file
+type linkRef struct {
+	filePath   string // file holding the linking Headline
+	title      string // title of the outline holding the linking Headline
+	headlineID int    // ID of the linking Headline
+	snippet    string // beginning of the linking Headline's text
+	target     link   // the link itself
+}
+
+// all of the links in all of the outlines, keyed by filepath
+type linkIndex map[string][]linkRef
+
+// Record the links of every outline beneath dir (from the cache, unless the outline has changed)
+func buildLinkIndex(dir string, cache *outlineCache) (linkIndex, error) {
+	li := make(linkIndex)
+	err := filepath.Walk(dir,
+		func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), ".gv") {
+				info, err := cache.infoFor(path, fi)
+				if err == nil { // Skip anything we can't read, it can't link to us anyway
+					li.update(path, info)
+				}
+			}
+			return nil
+		})
+	cache.save() // anything we had to read is cached for next time
+	return li, err
+}
+
+// (Re)record all of the links found in the outline at filePath
+func (li linkIndex) update(filePath string, info *outlineInfo) {
+	var refs []linkRef
+	for _, l := range info.Links {
+		refs = append(refs, linkRef{filePath, info.Title, l.HeadlineID, l.Snippet, link{outline: l.Outline, target: l.Target}})
+	}
+	if len(refs) == 0 {
+		delete(li, filePath)
+	} else {
+		li[filePath] = refs
+	}
+}
+
+// Forget the links in the outline at path, or in every outline beneath it if it is a Folder
+func (li linkIndex) forget(path string) {
+	for filePath := range li {
+		if filePath == path || strings.HasPrefix(filePath, path+string(filepath.Separator)) {
+			delete(li, filePath)
+		}
+	}
+}
+
+// Find every link pointing at Headline h (or the outline as a whole) in the outline stored at filePath.  They're
+//  sorted by the title of the outline they're in, then by snippet.
+func (li linkIndex) backlinksTo(filePath string, o *Outline, h *Headline) []linkRef {
+	var refs []linkRef
+	for from, found := range li {
+		for _, r := range found {
+			if r.target.outline == "" {
+				if from != filePath {
+					continue
+				}
+			} else if !strings.EqualFold(r.target.outline, o.Title) {
+				continue
+			}
+			if r.target.target == "" || r.target.refersTo(h) {
+				refs = append(refs, r)
+			}
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		if ti, tj := strings.ToLower(refs[i].title), strings.ToLower(refs[j].title); ti != tj {
+			return ti < tj
+		}
+		if refs[i].snippet != refs[j].snippet {
+			return refs[i].snippet < refs[j].snippet
+		}
+		if refs[i].filePath != refs[j].filePath {
+			return refs[i].filePath < refs[j].filePath
+		}
+		return refs[i].headlineID < refs[j].headlineID
+	})
+	return refs
+}
+
+// Does this link's target refer to the Headline h?
+func (l link) refersTo(h *Headline) bool {
+	if l.target == h.UID {
+		return true
+	}
+	if id, err := strconv.Atoi(l.target); err == nil && id == h.ID {
+		return true
+	}
+	return strings.EqualFold(strings.TrimSpace(h.plainText()), l.target)
+}
+
+// shorten text to fit in a backlink entry
+func snippet(text string) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) > backlinkSnippetLength {
+		runes = append(runes[:backlinkSnippetLength-1], ellipsis)
+	}
+	return string(runes)
+}
+
+// Show the backlinks for the current Headline in the Organizer
+func (org *organizer) showBacklinks(s tcell.Screen, e *editor) {
+	if org.links == nil {
+		li, err := buildLinkIndex(org.directory, org.cache)
+		if err != nil {
+			prompt(s, fmt.Sprintf("Error building link index; %v", err))
+			return
+		}
+		org.links = li
+	}
+	refs := org.links.backlinksTo(e.filePath(), e.out, e.out.currentHeadline(e))
+	entries := []*entry{}
+	for _, r := range refs {
+		name := fmt.Sprintf("%s: %s", r.title, r.snippet)
+		entries = append(entries, &entry{name: name, filename: r.filePath, headlineID: r.headlineID})
+	}
+	if len(entries) == 0 {
+		prompt(s, "No backlinks found")
+		return
+	}
+	org.enterMode(backlinksMode, entries)
+	drawTopBorder(s)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+/*
+
+The outline cache remembers what the Organizer needs to know about each outline (its title, how big it is, the
+#tags within it, the words in its Notes and its links) so it doesn't have to read every outline whenever it lists
+a Folder (or builds the link index for backlinks).  It is kept in $GVHOME and an entry is only trusted while its
+outline file has the same modification time and size as when it was read, and it was cached by this cacheVersion.
+
+The whole cache is brought up to date in the background when gv starts, so most Folders are listed straight from
+the cache.  Anything that has changed since is read (and cached) as it is listed.
+
+*/
+
+const defaultCacheFilename = "gv_cache.json"
+const cacheVersion = 1 // entries cached by any other version are read again (they may lack something we need)
+
+// what we know about an outline file
+type outlineInfo struct {
+	Title     string
+	ModTime   time.Time    // modification time of the file when it was read
+	Size      int64        // size of the file when it was read
+	Headlines int          // how many Headlines it has
+	Words     int          // how many words are in its Headlines (and Notes)
+	Tags      []string     `json:",omitempty"` // the #tags found in it (without the #), sorted
+	NoteWords []string     `json:",omitempty"` // the words in its Notes (in lower case, without punctuation), sorted
+	Links     []cachedLink `json:",omitempty"` // the links found in its Headlines and Notes
+	Version   int          // the cacheVersion it was cached with
+}
+
+// a link found in an outline (see links.go), as much of it as backlinks need
+type cachedLink struct {
+	HeadlineID int    // ID of the Headline the link is in
+	Snippet    string // beginning of the linking Headline's text
+	Outline    string // title of the target outline ("" means the same outline)
+	Target     string // text or ID of the target Headline ("" means the first Headline)
+}
+
+// Cached outlineInfo for every outline, keyed by the path to the outline relative to the base directory
+type outlineCache struct {
+	mu       sync.Mutex
+	baseDir  string
+	filePath string // where the cache is saved
+	outlines map[string]*outlineInfo
+	changed  bool // has the cache changed since it was saved?
+}
+
+// Load the cache from the file (starting an empty one if there isn't one yet)
+func loadOutlineCache(baseDir string, filePath string) *outlineCache {
+	c := &outlineCache{baseDir: baseDir, filePath: filePath, outlines: make(map[string]*outlineInfo)}
+	if buf, err := ioutil.ReadFile(filePath); err == nil {
+		if err := json.Unmarshal(buf, &c.outlines); err != nil || c.outlines == nil {
+			c.outlines = make(map[string]*outlineInfo) // we can always rebuild it
+		}
+	}
+	return c
+}
+
+// Write the cache to its file (if it has changed)
+func (c *outlineCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.changed {
+		return nil
+	}
+	buf, err := json.Marshal(c.outlines)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.filePath, buf, 0644); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
+
+func (c *outlineCache) key(path string) string {
+	return strings.TrimPrefix(filepath.Clean(path), c.baseDir)
+}
+
+// What we know about the outline at path.  It is read again if it has changed since it was cached.
+func (c *outlineCache) infoFor(path string, fi os.FileInfo) (*outlineInfo, error) {
+	c.mu.Lock()
+	info, found := c.outlines[c.key(path)]
+	c.mu.Unlock()
+	if found && info.Version == cacheVersion && info.ModTime.Equal(fi.ModTime()) && info.Size == fi.Size() {
+		return info, nil
+	}
+	out, err := loadOutline(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.update(path, fi, out), nil
+}
+
+// Cache what we know about out, which was just read from (or saved to) path
+func (c *outlineCache) update(path string, fi os.FileInfo, out *Outline) *outlineInfo {
+	info := summarize(out)
+	info.ModTime = fi.ModTime()
+	info.Size = fi.Size()
+	c.mu.Lock()
+	c.outlines[c.key(path)] = info
+	c.changed = true
+	c.mu.Unlock()
+	return info
+}
+
+// Forget about any outline that has gone from beneath dir (it was deleted, or moved and will be cached again
+//  under its new path)
+func (c *outlineCache) prune(dir string, present map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := c.key(dir) + string(filepath.Separator)
+	for key := range c.outlines {
+		if strings.HasPrefix(key, prefix) && !present[key] {
+			delete(c.outlines, key)
+			c.changed = true
+		}
+	}
+}
+
+// Bring the cache up to date with every outline beneath dir
+func (c *outlineCache) rebuild(dir string) error {
+	present := make(map[string]bool)
+	err := filepath.Walk(dir,
+		func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return nil // skip anything we can't read
+			}
+			if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), ".gv") {
+				if _, err := c.infoFor(path, fi); err == nil {
+					present[c.key(path)] = true
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	c.prune(dir, present)
+	return c.save()
+}
+
+// path (and info) of every cached outline whose title, #tags or Notes match all of the words in query
+func (c *outlineCache) search(query string) map[string]*outlineInfo {
+	terms := strings.Fields(strings.ToLower(query))
+	results := make(map[string]*outlineInfo)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, info := range c.outlines {
+		if info.matches(terms) {
+			results[filepath.Join(c.baseDir, key)] = info
+		}
+	}
+	return results
+}
+
+// Does every term appear in the title or a Note (or match the start of one of the tags)?
+func (info *outlineInfo) matches(terms []string) bool {
+	title := strings.ToLower(info.Title)
+	for _, term := range terms {
+		found := strings.Contains(title, term)
+		for _, tag := range info.Tags {
+			found = found || strings.HasPrefix(strings.ToLower(tag), strings.TrimPrefix(term, "#"))
+		}
+		for _, word := range info.NoteWords {
+			found = found || strings.Contains(word, term)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Count the Headlines and words in an outline and collect its tags, the words in its Notes and its links
+func summarize(out *Outline) *outlineInfo {
+	info := &outlineInfo{Title: out.Title, Version: cacheVersion}
+	tags := make(map[string]bool)
+	noteWords := make(map[string]bool)
+	count := func(text string) {
+		info.Words += len(strings.Fields(text))
+		for _, tag := range findTags(text) {
+			tags[tag] = true
+		}
+	}
+	out.walk(func(h *Headline, level int) {
+		info.Headlines++
+		count(h.plainText())
+		found := findLinks(&h.Buf)
+		if h.Note != nil {
+			found = append(found, findLinks(h.Note)...)
+		}
+		for _, l := range found {
+			info.Links = append(info.Links, cachedLink{h.ID, snippet(h.plainText()), l.outline, l.target})
+		}
+		if h.Note != nil {
+			text := strings.TrimSuffix(h.Note.Text(), emptyHeadlineText)
+			count(text)
+			for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+				noteWords[word] = true
+			}
+		}
+	})
+	for tag := range tags {
+		info.Tags = append(info.Tags, tag)
+	}
+	sort.Strings(info.Tags)
+	for word := range noteWords {
+		info.NoteWords = append(info.NoteWords, word)
+	}
+	sort.Strings(info.NoteWords)
+	return info
+}
+
+// Find the #tags in text.  A tag starts a word and is made of letters, digits, '-' and '_' (so the '#' in a
+//  [[Title#Headline]] link, or in "C#", isn't a tag).
+func findTags(text string) []string {
+	var tags []string
+	runes := []rune(text)
+	for i := 0; i < len(runes)-1; i++ {
+		if runes[i] != '#' || (i > 0 && !unicode.IsSpace(runes[i-1]) && !strings.ContainsRune("(,;", runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '-' || runes[end] == '_') {
+			end++
+		}
+		if end > i+1 && unicode.IsLetter(runes[i+1]) {
+			tags = append(tags, string(runes[i+1:end]))
+		}
+		i = end - 1
+	}
+	return tags
+}
+
+// The name to list an outline under
+func (info *outlineInfo) title() string {
+	if info.Title == "" {
+		return "no title"
+	}
+	return info.Title
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutlineCache(t *testing.T) {
+
+	fmt.Println("Find #tags")
+	tags := findTags("#todo see [[Plans#Goals]] and C# (#work, #2021 #home-office)")
+	if fmt.Sprint(tags) != "[todo work home-office]" {
+		t.Errorf("Fail: wanted tags [todo work home-office] got %v\n", tags)
+	}
+
+	fmt.Println("Summarize an outline")
+	o := newOutline("Plans")
+	one, _ := o.addHeadline("First thing #todo", -1)
+	o.addHeadline("Second #work thing", one)
+	o.headlineIndex[one].Note = NewPieceTable("a note #idea" + emptyHeadlineText)
+	info := summarize(o)
+	if info.Title != "Plans" || info.Headlines != 2 || info.Words != 9 || fmt.Sprint(info.Tags) != "[idea todo work]" {
+		t.Errorf("Fail: wanted Plans with 2 Headlines, 9 words and 3 tags got %+v\n", *info)
+	}
+	if fmt.Sprint(info.NoteWords) != "[a idea note]" {
+		t.Errorf("Fail: wanted the Note's words [a idea note] got %v\n", info.NoteWords)
+	}
+
+	fmt.Println("Cache entries are read again when their outline changes")
+	dir := t.TempDir()
+	storage := filepath.Join(dir, "outlines")
+	os.Mkdir(storage, 0700)
+	path := filepath.Join(storage, "plans.gv")
+	writeOutline := func(o *Outline) os.FileInfo {
+		buf, _ := json.Marshal(o)
+		ioutil.WriteFile(path, buf, 0644)
+		fi, _ := os.Stat(path)
+		return fi
+	}
+	c := loadOutlineCache(dir, filepath.Join(dir, defaultCacheFilename))
+	fi := writeOutline(o)
+	if info, err := c.infoFor(path, fi); err != nil || info.Title != "Plans" {
+		t.Fatalf("Fail: wanted Plans got %v (%v)\n", info, err)
+	}
+	if _, found := c.outlines["/outlines/plans.gv"]; !found {
+		t.Errorf("Fail: wanted an entry for /outlines/plans.gv got %v\n", c.outlines)
+	}
+	o.Title = "Longer Plans"
+	fi = writeOutline(o)
+	if info, _ := c.infoFor(path, fi); info.Title != "Longer Plans" {
+		t.Errorf("Fail: a changed outline should be read again, got %s\n", info.Title)
+	}
+
+	fmt.Println("The cache is saved and reloaded")
+	c.outlines["/outlines/gone.gv"] = &outlineInfo{Title: "Gone"}
+	if err := c.rebuild(storage); err != nil {
+		t.Fatal(err)
+	}
+	c = loadOutlineCache(dir, filepath.Join(dir, defaultCacheFilename))
+	if len(c.outlines) != 1 || c.outlines["/outlines/plans.gv"].Headlines != 2 {
+		t.Errorf("Fail: wanted just plans.gv in the reloaded cache got %v\n", c.outlines)
+	}
+
+	fmt.Println("Search titles and tags")
+	if results := c.search("plans #wor"); len(results) != 1 || results[path] == nil {
+		t.Errorf("Fail: wanted plans.gv to match got %v\n", results)
+	}
+	if results := c.search("plans #home"); len(results) != 0 {
+		t.Errorf("Fail: wanted no matches got %v\n", results)
+	}
+	if results := c.search("NOTE plans"); len(results) != 1 || results[path] == nil {
+		t.Errorf("Fail: wanted plans.gv to match the text of its Note got %v\n", results)
+	}
+
+	fmt.Println("Entries from an older cache are read again")
+	c.outlines["/outlines/plans.gv"].Version = 0
+	if info, _ := c.infoFor(path, fi); info.Version != cacheVersion || len(info.NoteWords) == 0 {
+		t.Errorf("Fail: wanted plans.gv read again got %+v\n", *info)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+/*
+
+The system clipboard.  Anything we copy is sent to the terminal with the OSC 52 escape sequence, which puts it on
+the system clipboard (tcell doesn't support the escape sequences we need, so we write them to the terminal
+ourselves).  Terminals don't let us read the clipboard the same way, so pasting runs the pasteCommand from gv.conf
+(e.g. "xclip -o -selection clipboard", "wl-paste -n" or "pbpaste").
+
+Headlines go on the clipboard as an indented list (or Markdown, if clipboardFormat is "markdown").  Text with
+several lines that is pasted into a Headline becomes several Headlines, indented text becoming children.  In the
+indented list the lines of a Note start with "| ", so they come back as the Note when pasted rather than as
+children of its Headline.
+
+*/
+
+const pasteCommandCfgKey = "pasteCommand"
+const clipboardFormatCfgKey = "clipboardFormat" // "text" (the default) or "markdown"
+
+const noteMarker = "| " // the start of each line of a Note in an indented list
+
+var errNoPasteCommand = errors.New("no pasteCommand configured")
+
+var pasteTimeout = 2 * time.Second // how long to wait for the pasteCommand before giving up on it
+
+var tty *os.File // our own handle on the terminal (nil until we need it)
+
+// Write an escape sequence straight to the terminal
+func writeTerminal(seq string) error {
+	if tty == nil {
+		f, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		tty = f
+	}
+	_, err := tty.WriteString(seq)
+	return err
+}
+
+// Put text on the system clipboard with the OSC 52 escape sequence.  The terminal does the work, so this works
+//  over ssh too.
+func copyToClipboard(text string) error {
+	return writeTerminal("\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a")
+}
+
+// Get the text on the system clipboard by running the pasteCommand.  It is killed if it takes too long (xclip
+//  waits forever when nothing owns the selection) so it can't hang the editor.
+func readClipboard() (string, error) {
+	command := strings.Fields(cfg[pasteCommandCfgKey])
+	if len(command) == 0 {
+		return "", errNoPasteCommand
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pasteTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, command[0], command[1:]...).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(string(out), "\r\n", "\n"), nil
+}
+
+// The text of a Headline, its Note and all of its children as an indented list (or as a Markdown list)
+func (h *Headline) clipboardText(markdown bool) string {
+	var b strings.Builder
+	h.walk(0, func(h *Headline, level int) {
+		indent := strings.Repeat("  ", level)
+		if markdown {
+			b.WriteString(indent + "- ")
+		} else {
+			b.WriteString(indent)
+		}
+		b.WriteString(h.plainText() + "\n")
+		if h.Note != nil && !h.noteIsEmpty() { // a Note's lines line up with its Headline's text (which Markdown needs)
+			marker := noteMarker // without bullets, only the marker tells a Note from the children
+			if markdown {
+				marker = ""
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(h.Note.Text(), emptyHeadlineText), "\n") {
+				b.WriteString(indent + "  " + marker + line + "\n")
+			}
+		}
+	})
+	return b.String()
+}
+
+// Turn lines of text into Headlines.  Each line becomes a Headline (without any list bullet it had), and
+//  lines indented further than the line before them become its children.  Lines starting with the noteMarker
+//  are the Note of the Headline before them.
+func (o *Outline) headlinesFromText(text string) []*Headline {
+	type parent struct {
+		indent   int
+		headline *Headline
+	}
+	var roots []*Headline
+	var parents []parent // the Headlines that could be a parent of the next line, least indented first
+	var note []string    // the lines of the Note of the most recent Headline
+	addNote := func() {
+		if len(note) > 0 {
+			h := parents[len(parents)-1].headline
+			h.Note = NewPieceTable(strings.Join(note, "\n") + emptyHeadlineText)
+			h.ShowNote = true
+			note = nil
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		content := strings.TrimLeft(line, " \t")
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		if content+" " == noteMarker {
+			content = noteMarker // an empty line of a Note that lost its trailing space
+		}
+		if len(parents) > 0 && strings.HasPrefix(content, noteMarker) {
+			note = append(note, content[len(noteMarker):])
+			continue
+		}
+		addNote()
+		indent := indentOf(line[:len(line)-len(content)])
+		for _, bullet := range []string{"- ", "* ", "+ ", "• "} {
+			if strings.HasPrefix(content, bullet) {
+				content = content[len(bullet):]
+				break
+			}
+		}
+		for len(parents) > 0 && parents[len(parents)-1].indent >= indent {
+			parents = parents[:len(parents)-1]
+		}
+		if len(parents) == 0 {
+			h := o.newHeadline(strings.TrimSpace(content), -1)
+			roots = append(roots, h)
+			parents = append(parents, parent{indent, h})
+		} else {
+			p := parents[len(parents)-1].headline
+			h := o.newHeadline(strings.TrimSpace(content), p.ID)
+			p.Children = append(p.Children, h)
+			parents = append(parents, parent{indent, h})
+		}
+	}
+	addNote()
+	return roots
+}
+
+// how many columns of whitespace (tabs count as 4)
+func indentOf(whitespace string) int {
+	indent := 0
+	for _, r := range whitespace {
+		if r == '\t' {
+			indent += 4
+		} else {
+			indent++
+		}
+	}
+	return indent
+}
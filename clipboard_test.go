@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClipboard(t *testing.T) {
+
+	fmt.Println("Copy Headlines as text")
+	o := newOutline("Test")
+	one, _ := o.addHeadline("One", -1)
+	a, _ := o.addHeadline("A", one)
+	o.addHeadline("i", a)
+	b, _ := o.addHeadline("B", one)
+	o.addHeadline("Two", -1)
+	note := o.headlineIndex[b]
+	note.Note = NewPieceTable("first\nsecond" + emptyHeadlineText)
+	if text := o.headlineIndex[one].clipboardText(false); text != "One\n  A\n    i\n  B\n    | first\n    | second\n" {
+		t.Errorf("Fail: copying as text got >%s<\n", text)
+	}
+	if text := o.headlineIndex[one].clipboardText(true); text != "- One\n  - A\n    - i\n  - B\n    first\n    second\n" {
+		t.Errorf("Fail: copying as Markdown got >%s<\n", text)
+	}
+
+	fmt.Println("A copied Note comes back as a Note")
+	roots := o.headlinesFromText(o.headlineIndex[one].clipboardText(false))
+	if len(roots) != 1 || len(roots[0].Children) != 2 {
+		t.Fatalf("Fail: wanted One with children A and B got %v\n", roots)
+	}
+	pastedB := roots[0].Children[1]
+	if pastedB.plainText() != "B" || len(pastedB.Children) != 0 || pastedB.Note == nil || pastedB.Note.Text() != "first\nsecond"+emptyHeadlineText || !pastedB.ShowNote {
+		t.Errorf("Fail: wanted B with its Note and no children got %v\n", pastedB)
+	}
+	roots = o.headlinesFromText("x\n  | one\n  |\n  | three\n  y")
+	if len(roots) != 1 || roots[0].Note == nil || roots[0].Note.Text() != "one\n\nthree"+emptyHeadlineText || len(roots[0].Children) != 1 {
+		t.Errorf("Fail: wanted x with a Note of three lines and child y got %v\n", roots)
+	}
+
+	fmt.Println("Turn pasted text into Headlines")
+	roots = o.headlinesFromText("x\n\t- y\n\n      * z\n  w\nv")
+	if len(roots) != 2 || roots[0].plainText() != "x" || roots[1].plainText() != "v" {
+		t.Fatalf("Fail: wanted x and v got %v\n", roots)
+	}
+	children := roots[0].Children
+	if len(children) != 2 || children[0].plainText() != "y" || children[1].plainText() != "w" {
+		t.Fatalf("Fail: wanted x to have children y and w got %v\n", children)
+	}
+	if len(children[0].Children) != 1 || children[0].Children[0].plainText() != "z" || children[0].Children[0].ParentID != children[0].ID {
+		t.Errorf("Fail: wanted y to have child z got %v\n", children[0].Children)
+	}
+
+	fmt.Println("Paste several lines after the current Headline")
+	e := &editor{out: o, currentHeadlineID: a}
+	e.pasteText("p\r\n  q\r\nr\r\n")
+	parent := o.headlineIndex[one]
+	var texts []string
+	for _, c := range parent.Children {
+		texts = append(texts, c.plainText())
+	}
+	if fmt.Sprint(texts) != "[A p r B]" {
+		t.Fatalf("Fail: wanted children [A p r B] got %v\n", texts)
+	}
+	p := parent.Children[1]
+	if p.ParentID != one || len(p.Children) != 1 || o.headlineIndex[p.Children[0].ID] == nil || e.currentHeadlineID != p.ID {
+		t.Errorf("Fail: pasted Headline p is %+v (cursor on %d)\n", p, e.currentHeadlineID)
+	}
+
+	fmt.Println("Paste a single line at the cursor, replacing the selection")
+	e.currentHeadlineID = b
+	e.sel = &selection{b, 0, 0}
+	e.currentPosition = 0
+	e.pasteText("Bee\n")
+	if text := o.headlineIndex[b].plainText(); text != "Bee" || e.currentPosition != 3 || e.sel != nil {
+		t.Errorf("Fail: pasting over the selection got >%s< cursor %d\n", text, e.currentPosition)
+	}
+	o.headlineIndex[b].Buf.Undo()
+	if text := o.headlineIndex[b].plainText(); text != "B" {
+		t.Errorf("Fail: a paste should undo in one step, got >%s<\n", text)
+	}
+
+	fmt.Println("Paste several lines over the selection")
+	e.currentHeadlineID = b
+	o.headlineIndex[b].Buf.Insert(1, "ee")
+	e.sel = &selection{b, 0, 0}
+	e.pasteText("s\nt")
+	if text := o.headlineIndex[b].plainText(); text != "ee" || e.sel != nil {
+		t.Errorf("Fail: the selection should be removed before pasting Headlines, got >%s<\n", text)
+	}
+
+	fmt.Println("Paste our own copy when the system clipboard still has it")
+	cfg = make(config)
+	cfg[pasteCommandCfgKey] = "echo e"
+	e.currentHeadlineID = b
+	e.currentPosition = 0
+	e.sel = &selection{b, 0, 0}
+	e.copySelection()
+	e.sel = nil
+	e.paste()
+	if text := o.headlineIndex[b].plainText(); text != "eee" {
+		t.Errorf("Fail: wanted our own copy pasted got >%s<\n", text)
+	}
+
+	fmt.Println("Paste the system clipboard once something else has been copied")
+	cfg[pasteCommandCfgKey] = "echo other"
+	e.currentPosition = 0
+	e.paste()
+	if text := o.headlineIndex[b].plainText(); text != "othereee" {
+		t.Errorf("Fail: wanted the system clipboard pasted got >%s<\n", text)
+	}
+
+	fmt.Println("Copying doesn't run the pasteCommand")
+	ran := filepath.Join(t.TempDir(), "ran")
+	cfg[pasteCommandCfgKey] = "touch " + ran
+	e.currentHeadlineID = a
+	e.copyHeadline()
+	if _, err := os.Stat(ran); err == nil {
+		t.Errorf("Fail: copying ran the pasteCommand\n")
+	}
+
+	fmt.Println("Paste our own Headlines without a pasteCommand")
+	delete(cfg, pasteCommandCfgKey)
+	e.currentHeadlineID = b
+	e.paste()
+	if c := o.headlineIndex[b].Children; len(c) != 1 || c[0].plainText() != "A" || len(c[0].Children) != 1 {
+		t.Errorf("Fail: wanted the copied Headline A pasted got %v\n", c)
+	}
+	cfg[pasteCommandCfgKey] = "echo another"
+	e.currentHeadlineID = b
+	e.currentPosition = 0
+	e.paste()
+	if text := o.headlineIndex[b].plainText(); text != "anotherothereee" {
+		t.Errorf("Fail: wanted the changed system clipboard pasted got >%s<\n", text)
+	}
+
+	fmt.Println("Give up on a pasteCommand that hangs")
+	cfg[pasteCommandCfgKey] = "sleep 10"
+	pasteTimeout = 100 * time.Millisecond
+	start := time.Now()
+	if _, err := readClipboard(); err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("Fail: wanted the pasteCommand to time out, got %v after %v\n", err, time.Since(start))
+	}
+	pasteTimeout = 2 * time.Second
+	cfg = make(config)
+}
@@ -21,19 +21,29 @@ the editor's window.
 */
 
 type editor struct {
-	org                *organizer // pointer to the organizer
-	out                *Outline   // current outline being edited
-	lineIndex          []*line    // Text Position index for each "line" after editor has been laid out.
-	linePtr            int        // index of the line currently beneath the cursor
-	editorWidth        int        // width of an editor column
-	editorHeight       int        // height of the editor window
-	currentHeadlineID  int        // ID of headline cursor is on
-	currentPosition    int        // the current position within the currentHeadline.Buf
-	topLine            int        // index of the topmost "line" of the window in lineIndex
-	dirty              bool       // Is the outliine buffer modified since last save?
-	sel                *selection // pointer to the current selection (nil means we are not selecting any text)
-	headlineClipboard  *Headline  // pointer to the currently copied/cut Headline (nil if nothing being copied/cut)
-	selectionClipboard *[]rune    // pointer to a slice of runes containing copied/cut selecton text (nil if nothing copied/cut)
+	org                *organizer                    // pointer to the organizer
+	out                *Outline                      // current outline being edited
+	lineIndex          []*line                       // Text Position index for each "line" after editor has been laid out.
+	linePtr            int                           // index of the line currently beneath the cursor
+	editorWidth        int                           // width of an editor column
+	editorHeight       int                           // height of the editor window
+	currentHeadlineID  int                           // ID of headline cursor is on
+	currentPosition    int                           // the current position within the currentHeadline.Buf (or its Note)
+	inNote             bool                          // is the cursor within the current Headline's Note instead of its text?
+	topLine            int                           // index of the topmost "line" of the window in lineIndex
+	dirty              bool                          // Is the outliine buffer modified since last save?
+	sel                *selection                    // pointer to the current selection (nil means we are not selecting any text)
+	headlineClipboard  *Headline                     // pointer to the currently copied/cut Headline (nil if nothing being copied/cut)
+	headlineCut        bool                          // was the Headline in the clipboard cut (i.e. it is being moved, not copied)?
+	selectionClipboard *[]rune                       // pointer to a slice of runes containing copied/cut selecton text (nil if nothing copied/cut)
+	linkHistory        []linkLocation                // where we were before following each link (most recent last)
+	layouts            map[*Headline]*headlineLayout // how each Headline was last laid out
+	laidOut            *Outline                      // the outline the layouts belong to
+	visibleOrder       []int                         // IDs of the visible Headlines, in the order they're displayed
+	visibleIndex       map[int]int                   // where each visible Headline's ID is within visibleOrder
+	markersIn          *Headline                     // the Headline laid out with its formatting markers showing (nil if none)
+	clipboardText      string                        // what we last put on the system clipboard
+	totals             outlineTotals                 // running totals of Headlines, words and characters (for the stats)
 }
 
 // a line is a logical representation of a line that is rendered in the window
@@ -44,6 +54,7 @@ type line struct {
 	hangingIndent int  // Indent for text without a bullet
 	position      int  // Text position in o.lineIndex[headlineID].Buf.Runes()
 	length        int  // How many runes in this "line"
+	note          bool // Is this a line of the Headline's Note rather than its text?
 }
 
 // A selection indicates the start and end positions of contiguous Headline text that is selected
@@ -66,7 +77,7 @@ func (e *editor) setScreenSize(s tcell.Screen) {
 }
 
 func newEditor(s tcell.Screen, org *organizer) *editor {
-	ed := &editor{org, nil, nil, 0, 0, 0, 0, 0, 0, false, nil, nil, nil}
+	ed := &editor{org, nil, nil, 0, 0, 0, 0, 0, false, 0, false, nil, nil, false, nil, nil, nil, nil, nil, nil, nil, "", outlineTotals{}}
 	lastOutlineFilePath, found := cfg[lastOpenedOutlineCfgKey]
 	if found {
 		ed.open(s, lastOutlineFilePath)
@@ -78,13 +89,39 @@ func newEditor(s tcell.Screen, org *organizer) *editor {
 
 func (e *editor) isSelecting() bool { return e.sel != nil }
 
+// the position just after the selection (the selection includes all of the character at its endPosition)
+func (e *editor) selectionEnd() int {
+	return nextClusterStart(e.currentBuf(), e.sel.endPosition)
+}
+
+// the buffer beneath the cursor- either the current Headline's text or its Note
+func (e *editor) currentBuf() *PieceTable {
+	h := e.out.currentHeadline(e)
+	if e.inNote && h.Note != nil {
+		return h.Note
+	}
+	return &h.Buf
+}
+
 // save the outline buffer to a file
 func (e *editor) save(filename string) error {
+	e.out.compact()
 	buf, err := json.Marshal(e.out)
 	if err != nil {
 		return err
 	}
-	ioutil.WriteFile(filename, buf, 0644)
+	if err := ioutil.WriteFile(filename, buf, 0644); err != nil {
+		return err
+	}
+	if e.org.cache != nil {
+		if fi, err := os.Stat(filename); err == nil {
+			info := e.org.cache.update(filename, fi, e.out)
+			e.org.cache.save()
+			if e.org.links != nil {
+				e.org.links.update(filename, info)
+			}
+		}
+	}
 	return nil
 }
 
@@ -94,12 +131,15 @@ func (e *editor) saveFirst(s tcell.Screen) bool {
 	if response != "" {
 		if strings.ToUpper(response) == "Y" {
 			if currentFilename != "" {
-				e.save(filepath.Join(org.currentDirectory, currentFilename))
+				if err := e.save(e.filePath()); err != nil {
+					prompt(s, fmt.Sprintf("Error saving file: %v", err))
+				}
 			} else {
 				f := prompt(s, "Filename: ")
 				if f != "" {
 					currentFilename = f
-					err := e.save(filepath.Join(org.currentDirectory, currentFilename))
+					currentFileDirectory = org.currentDirectory
+					err := e.save(e.filePath())
 					if err == nil {
 						e.dirty = false
 						org.refresh(s)
@@ -115,10 +155,15 @@ func (e *editor) saveFirst(s tcell.Screen) bool {
 	return false
 }
 
+// full path to the file holding the outline being edited
+func (e *editor) filePath() string {
+	return filepath.Join(currentFileDirectory, currentFilename)
+}
+
 // store this filePath as last opened Outline
 func (e *editor) rememberOutline(filePath string) {
 	cfg[lastOpenedOutlineCfgKey] = filePath
-	saveConfig()
+	addRecent(filePath) // (saves the config)
 }
 
 // user wants to create a new outline, save an existing, dirty one first
@@ -129,25 +174,48 @@ func (e *editor) newOutline(s tcell.Screen, title string) error {
 		proceed = e.saveFirst(s)
 	}
 	if proceed {
+		var template *Outline
 		if title == "" {
 			title = prompt(s, "Enter new outline title:")
+			if title != "" {
+				var ok bool
+				if template, ok = e.chooseTemplate(s, title); !ok {
+					return nil
+				}
+			}
 		}
 		if title != "" {
-			e.out = newOutline(title)
-			e.out.init(e)
-			e.linePtr = 0
-			e.topLine = 0
-			e.dirty = true
-			currentFilename = generateFilename(e.out.Title, ".gv")
-			e.sel = nil
-			filePath := filepath.Join(org.currentDirectory, currentFilename)
-			e.save(filePath)
-			e.rememberOutline(filePath)
+			if template == nil {
+				template = newOutline(title)
+			}
+			e.startOutline(template, org.currentDirectory, generateFilename(title, ".gv"))
 		}
 	}
 	return nil
 }
 
+// Start editing out, a new outline, and save it as filename in dir.  A new outline without any Headlines is
+//  given a blank one.
+func (e *editor) startOutline(out *Outline, dir string, filename string) {
+	e.out = out
+	if len(out.Headlines) == 0 {
+		out.init(e)
+	} else {
+		e.currentHeadlineID = out.Headlines[0].ID
+		e.currentPosition = 0
+	}
+	e.inNote = false
+	e.linePtr = 0
+	e.topLine = 0
+	e.dirty = true
+	currentFilename = filename
+	currentFileDirectory = dir
+	e.sel = nil
+	filePath := e.filePath()
+	e.save(filePath)
+	e.rememberOutline(filePath)
+}
+
 // user wants to open this outline, save an existing, dirty one first
 func (e *editor) open(s tcell.Screen, filePath string) error {
 	proceed := true
@@ -159,6 +227,7 @@ func (e *editor) open(s tcell.Screen, filePath string) error {
 		err := e.load(filePath)
 		if err == nil {
 			currentFilename = filepath.Base(filePath)
+			currentFileDirectory = filepath.Dir(filePath)
 		} else {
 			msg := fmt.Sprintf("Error opening file: %v", err)
 			prompt(s, msg)
@@ -170,37 +239,48 @@ func (e *editor) open(s tcell.Screen, filePath string) error {
 
 // load a .gv file and use it to populate the outline's buffer
 func (e *editor) load(filename string) error {
-	buf, err := ioutil.ReadFile(filename)
+	out, err := loadOutline(filename)
 	if err != nil {
 		return err
 	}
-	// Extract the outline JSON
-	e.out = nil
-	err = json.Unmarshal(buf, &(e.out))
-	if err != nil {
-		return err
-	}
-	if len(e.out.Headlines) == 0 {
-		return fmt.Errorf("Error: did not read any headlines from the input file")
-	}
-	// (Re)build the headlineIndex
-	e.out.headlineIndex = make(map[int]*Headline)
-	for _, h := range e.out.Headlines {
-		e.out.addHeadlineToIndex(h)
-	}
+	e.out = out
 	e.currentHeadlineID = e.out.Headlines[0].ID
 	e.currentPosition = 0
+	e.inNote = false
 	e.linePtr = 0
 	e.topLine = 0
-	e.dirty = false
+	e.dirty = out.migrate() // an outline from an older version needs saving (so its new UIDs stick)
 	e.sel = nil
 	return nil
 }
 
+// read an Outline from a .gv file
+func loadOutline(filename string) (*Outline, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// Extract the outline JSON
+	var out *Outline
+	err = json.Unmarshal(buf, &out)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil || len(out.Headlines) == 0 {
+		return nil, fmt.Errorf("Error: did not read any headlines from the input file")
+	}
+	// (Re)build the headlineIndex
+	out.headlineIndex = make(map[int]*Headline)
+	for _, h := range out.Headlines {
+		out.addHeadlineToIndex(h)
+	}
+	return out, nil
+}
+
 // Store a 'logical' line- this is a rendered line of text on the screen. We use this index
 // to figure out where in the outline buffer to move to when we navigate visually
-func (e *editor) recordLogicalLine(id int, bullet rune, indent int, hangingIndent int, position int, length int) {
-	e.lineIndex = append(e.lineIndex, &line{id, bullet, indent, hangingIndent, position, length})
+func (e *editor) recordLogicalLine(id int, bullet rune, indent int, hangingIndent int, position int, length int, note bool) {
+	e.lineIndex = append(e.lineIndex, &line{id, bullet, indent, hangingIndent, position, length, note})
 }
 
 // Clear out the contents of the organizer's window
@@ -216,10 +296,27 @@ func (e *editor) clear(s tcell.Screen) {
 
 func (e *editor) draw(s tcell.Screen) {
 	e.layoutOutline(s)
+	e.render(s)
+}
+
+// Draw after the cursor has moved, or the text beneath it (in the current Headline or its Note) has been edited.
+//  Nothing else can have changed, so only the current Headline is laid out again.
+func (e *editor) drawEdit(s tcell.Screen) {
+	if !e.layoutCurrent() {
+		e.layoutOutline(s)
+	}
+	e.render(s)
+}
+
+func (e *editor) render(s tcell.Screen) {
+	e.scrollToCursor()
 	e.clear(s)
-	e.renderOutline(s)
+	hyperlinks := e.renderOutline(s)
+	drawBottomBorder(s)
+	drawScrollbar(s, screenWidth-1, len(e.lineIndex), e.topLine, e.editorHeight)
 	s.ShowCursor(cursX, cursY)
 	s.Show()
+	showHyperlinks(s, hyperlinks)
 }
 
 func (e *editor) handleEvents(s tcell.Screen) {
@@ -236,51 +333,91 @@ func (e *editor) handleEvents(s tcell.Screen) {
 				if mod == tcell.ModCtrl {
 					e.out.currentHeadline(e).Expanded = true
 					e.setDirty(s, true)
+				} else if mod == tcell.ModCtrl|tcell.ModShift {
+					e.out.setExpandedAll(true)
+					e.setDirty(s, true)
+				} else if mod == tcell.ModAlt {
+					e.out.currentHeadline(e).setExpandedRecursive(true)
+					e.setDirty(s, true)
 				} else if mod == tcell.ModShift {
 					e.selectDown()
 				} else {
 					e.moveDown()
 				}
-				e.draw(s)
+				if mod == tcell.ModNone || mod == tcell.ModShift {
+					e.drawEdit(s)
+				} else {
+					e.draw(s)
+				}
 			case tcell.KeyUp:
 				if mod == tcell.ModCtrl {
 					e.out.currentHeadline(e).Expanded = false
 					e.setDirty(s, true)
+				} else if mod == tcell.ModCtrl|tcell.ModShift {
+					e.out.setExpandedAll(false)
+					e.keepCursorVisible()
+					e.setDirty(s, true)
+				} else if mod == tcell.ModAlt {
+					e.out.currentHeadline(e).setExpandedRecursive(false)
+					e.setDirty(s, true)
 				} else if mod == tcell.ModShift {
 					e.selectUp()
 				} else {
 					e.moveUp()
 				}
-				e.draw(s)
+				if mod == tcell.ModNone || mod == tcell.ModShift {
+					e.drawEdit(s)
+				} else {
+					e.draw(s)
+				}
 			case tcell.KeyPgUp:
 				e.pageUp()
-				e.draw(s)
+				e.drawEdit(s)
 			case tcell.KeyPgDn:
 				e.pageDown()
-				e.draw(s)
+				e.drawEdit(s)
 			case tcell.KeyRight:
+				if mod == tcell.ModAlt && e.stepJournal(s, 1) {
+					drawScreen(s)
+					break
+				}
 				e.moveRight(mod == tcell.ModShift)
-				e.draw(s)
+				e.drawEdit(s)
 			case tcell.KeyLeft:
+				if mod == tcell.ModAlt && e.stepJournal(s, -1) {
+					drawScreen(s)
+					break
+				}
 				e.moveLeft(mod == tcell.ModShift)
-				e.draw(s)
+				e.drawEdit(s)
 			case tcell.KeyHome:
 				e.moveHome(mod == tcell.ModShift)
-				e.draw(s)
+				e.drawEdit(s)
 			case tcell.KeyEnd:
 				e.moveEnd(mod == tcell.ModShift)
-				e.draw(s)
+				e.drawEdit(s)
 			case tcell.KeyBackspace, tcell.KeyBackspace2:
+				joining := !e.inNote && e.currentPosition == 0 // (onto the previous Headline)
 				e.backspace(e.out)
-				e.draw(s)
+				if joining {
+					e.draw(s)
+				} else {
+					e.drawEdit(s)
+				}
 				e.setDirty(s, true)
 			case tcell.KeyDelete:
 				if mod == tcell.ModCtrl {
 					e.deleteHeadline(e.out)
+					e.draw(s)
 				} else {
+					joining := !e.inNote && e.currentPosition == e.currentBuf().Len()-1 // (the next Headline onto this one)
 					e.delete(e.out)
+					if joining {
+						e.draw(s)
+					} else {
+						e.drawEdit(s)
+					}
 				}
-				e.draw(s)
 				e.setDirty(s, true)
 			case tcell.KeyEnter:
 				e.enterPressed(e.out)
@@ -295,8 +432,17 @@ func (e *editor) handleEvents(s tcell.Screen) {
 				e.draw(s)
 				e.setDirty(s, true)
 			case tcell.KeyRune:
-				e.insertRuneAtCurrentPosition(e.out, ev.Rune())
-				e.draw(s)
+				if mod == tcell.ModAlt && ev.Rune() >= '1' && ev.Rune() <= '9' { // show only levels 1..N
+					e.out.showToLevel(int(ev.Rune() - '0'))
+					e.keepCursorVisible()
+					e.draw(s)
+				} else if marker, found := formatKeys[ev.Rune()]; found && mod == tcell.ModAlt {
+					e.toggleFormat(marker)
+					e.drawEdit(s)
+				} else {
+					e.insertRuneAtCurrentPosition(e.out, ev.Rune())
+					e.drawEdit(s)
+				}
 				e.setDirty(s, true)
 			case tcell.KeyCtrlB:
 				if e.out.Bullets == glyphBullet { // TODO: This will need to change when we support more bullet types
@@ -314,16 +460,41 @@ func (e *editor) handleEvents(s tcell.Screen) {
 				}
 			case tcell.KeyCtrlF: // for debugging
 				e.out.dump(e)
+			case tcell.KeyCtrlN:
+				e.toggleNote()
+				e.draw(s)
+				e.setDirty(s, true)
+			case tcell.KeyCtrlRightSq:
+				e.followLink(s)
+				drawScreen(s)
+			case tcell.KeyCtrlO:
+				e.followLinkBack(s)
+				drawScreen(s)
+			case tcell.KeyCtrlU:
+				e.openURL(s)
+				drawScreen(s)
+			case tcell.KeyCtrlR:
+				org.showBacklinks(s, e)
+				if org.mode == backlinksMode {
+					org.handleEvents(s, e.out)
+				}
+				drawScreen(s)
+			case tcell.KeyCtrlZ:
+				if e.undo() {
+					e.drawEdit(s)
+					e.setDirty(s, true)
+				}
+			case tcell.KeyCtrlY:
+				if e.redo() {
+					e.drawEdit(s)
+					e.setDirty(s, true)
+				}
 			case tcell.KeyCtrlL:
 				e.out.MultiList = !e.out.MultiList
 				e.draw(s)
 				e.setDirty(s, true)
 			case tcell.KeyCtrlV:
-				if e.isSelecting() {
-					e.pasteSelection()
-				} else {
-					e.pasteHeadline()
-				}
+				e.paste()
 				e.draw(s)
 				e.setDirty(s, true)
 			case tcell.KeyCtrlX:
@@ -339,7 +510,8 @@ func (e *editor) handleEvents(s tcell.Screen) {
 					f := prompt(s, "Filename: ")
 					if f != "" {
 						currentFilename = f
-						err := e.save(filepath.Join(org.currentDirectory, currentFilename))
+						currentFileDirectory = org.currentDirectory
+						err := e.save(e.filePath())
 						if err == nil {
 							e.setDirty(s, false)
 						} else {
@@ -349,10 +521,17 @@ func (e *editor) handleEvents(s tcell.Screen) {
 						org.refresh(s)
 						drawScreen(s)
 					}
-				} else {
-					e.save(filepath.Join(org.currentDirectory, currentFilename))
+				} else if err := e.save(e.filePath()); err == nil {
 					e.setDirty(s, false)
+				} else {
+					prompt(s, fmt.Sprintf("Error saving file: %v", err))
 				}
+			case tcell.KeyCtrlP:
+				e.quickOpen(s)
+				drawScreen(s)
+			case tcell.KeyCtrlG:
+				e.goToHeadline(s)
+				drawScreen(s)
 			case tcell.KeyCtrlT:
 				e.editOutlineTitle(s, e.out)
 				e.draw(s)
@@ -364,6 +543,9 @@ func (e *editor) handleEvents(s tcell.Screen) {
 				}
 				org.handleEvents(s, e.out)
 				drawScreen(s)
+			case tcell.KeyF2:
+				e.openTodaysJournal(s)
+				drawScreen(s)
 			case tcell.KeyF1:
 				showHelp(s)
 				prompt(s, "")
@@ -14,19 +14,62 @@ Layout and rendering methods for the editor.
 
 */
 
+const noteIndent = 2 // how much further a Note is indented beyond its Headline's text
+
+// Everything a Headline's layout depends on.  If none of it has changed, the Headline's lines haven't either.
+type layoutKey struct {
+	textVersion   uint64
+	noteVersion   uint64 // 0 if the Note isn't shown
+	width         int
+	level         int
+	indent        int
+	hangingIndent int
+	bullet        rune
+	textMarkers   bool // are the formatting markers in the text shown (so they take up space)?
+	noteMarkers   bool // are the formatting markers in the Note shown?
+}
+
+// the lines a Headline (and its Note) were laid out as
+type headlineLayout struct {
+	key   layoutKey
+	lines []*line
+}
+
+// Lay out the whole outline into lineIndex.  Only Headlines that have changed since the last layout are
+//  word-wrapped again, the rest reuse the lines they had last time.
 func (e *editor) layoutOutline(s tcell.Screen) {
 	y := 1
 
 	// clear out lineIndex (avoid a re-allocation)
-	for l := range ed.lineIndex {
-		ed.lineIndex[l] = nil
+	for l := range e.lineIndex {
+		e.lineIndex[l] = nil
+	}
+	e.lineIndex = e.lineIndex[:0]
+	e.visibleOrder = e.visibleOrder[:0]
+	e.markersIn = nil
+	if e.laidOut != e.out || e.visibleIndex == nil { // forget everything about any other outline
+		e.layouts = make(map[*Headline]*headlineLayout)
+		e.visibleIndex = make(map[int]int)
+		e.laidOut = e.out
+	} else {
+		for id := range e.visibleIndex {
+			delete(e.visibleIndex, id)
+		}
 	}
-	ed.lineIndex = ed.lineIndex[:0]
 
 	// Layout each Headline
-	for _, h := range ed.out.Headlines {
+	for _, h := range e.out.Headlines {
 		y = e.layoutHeadline(s, h, 1, y)
 	}
+
+	if len(e.layouts) > 2*len(e.visibleOrder)+16 { // lots of hidden (or deleted) Headlines are being remembered
+		layouts := make(map[*Headline]*headlineLayout, len(e.visibleOrder))
+		for _, id := range e.visibleOrder {
+			h := e.out.headlineIndex[id]
+			layouts[h] = e.layouts[h]
+		}
+		e.layouts = layouts
+	}
 }
 
 // Format headline text according to indent and word-wrap.  Layout all of its children.
@@ -57,41 +100,22 @@ func (e *editor) layoutHeadline(s tcell.Screen, h *Headline, level int, y int) i
 			hangingIndent = indent
 		}
 	}
-	text := h.Buf.Runes()
-	pos := 0
-	end := len(*text)
-	firstLine := true
-	for pos < end {
-		endPos := pos + e.editorWidth - (level * 3) - 2
-		if endPos > end { // overshot end of text, we're on the first or last fragment
-			var mybullet rune
-			if firstLine { // if we're laying out first line less than editor width, remember that we want to use a bullet
-				mybullet = bullet
-				firstLine = false
-			}
-			e.recordLogicalLine(h.ID, mybullet, indent, hangingIndent, pos, end-pos)
-			endPos = end
-			endY++
-		} else { // on first or middle fragment
-			var mybullet rune
-			if firstLine { // if we're laying out first line of a multi-line headline, remember that we want to use a bullet
-				mybullet = bullet
-				firstLine = false
-			}
-			if endPos < len(*text) && !unicode.IsSpace((*text)[endPos]) {
-				// Walk backwards until you see your first whitespace
-				p := endPos
-				for p > pos && !unicode.IsSpace((*text)[p]) {
-					p--
-				}
-				if p != pos { // split at the space (hitting pos means beginning of text or last starting point)
-					endPos = p + 1
-				}
-			}
-			e.recordLogicalLine(h.ID, mybullet, indent, hangingIndent, pos, endPos-pos)
-			endY++
-		}
-		pos = endPos
+	e.visibleIndex[h.ID] = len(e.visibleOrder)
+	e.visibleOrder = append(e.visibleOrder, h.ID)
+
+	key := layoutKey{h.Buf.Version(), 0, e.editorWidth, level, indent, hangingIndent, bullet, false, false}
+	if h.Note != nil && h.ShowNote {
+		key.noteVersion = h.Note.Version()
+	}
+	key.textMarkers, key.noteMarkers = e.markersShown(h)
+	if key.textMarkers || key.noteMarkers {
+		e.markersIn = h
+	}
+	if cached, found := e.layouts[h]; found && cached.key == key { // nothing has changed
+		e.lineIndex = append(e.lineIndex, cached.lines...)
+		endY += len(cached.lines)
+	} else {
+		endY += e.layoutText(h, key)
 	}
 
 	// Unless headline is collapsed, render its children
@@ -104,31 +128,210 @@ func (e *editor) layoutHeadline(s tcell.Screen, h *Headline, level int, y int) i
 	return endY
 }
 
+// Which of h's text and Note show their formatting markers.  Only the text under the cursor does (see format.go),
+//  and it only makes a difference to text that has some formatting.
+func (e *editor) markersShown(h *Headline) (bool, bool) {
+	text := e.showsMarkers(h.ID, false) && len(findFormatting(&h.Buf)) > 0
+	note := h.Note != nil && h.ShowNote && e.showsMarkers(h.ID, true) && len(findFormatting(h.Note)) > 0
+	return text, note
+}
+
+// Are the formatting markers shown in the text (or Note) of the Headline with this ID?
+func (e *editor) showsMarkers(ID int, note bool) bool {
+	return ID == e.currentHeadlineID && note == e.inNote
+}
+
+// Word-wrap a Headline's text (and its Note, if it is showing) onto the end of lineIndex and remember the lines
+//  in its layout.  Hidden formatting markers take up no room.  Returns how many lines there are.
+func (e *editor) layoutText(h *Headline, key layoutKey) int {
+	first := len(e.lineIndex)
+	pos := 0
+	end := h.Buf.Len()
+	width := e.editorWidth - (key.level * 3) - 2
+	var hidden []span
+	if !key.textMarkers {
+		hidden = findFormatting(&h.Buf)
+	}
+	firstLine := true
+	for pos < end {
+		var mybullet rune
+		if firstLine { // only the first line of a Headline gets a bullet
+			mybullet = key.bullet
+			firstLine = false
+		}
+		endPos := fitWidth(&h.Buf, pos, end, width, hidden)
+		if endPos < end { // on first or middle fragment
+			endPos = wordWrap(&h.Buf, pos, endPos)
+		}
+		e.recordLogicalLine(h.ID, mybullet, key.indent, key.hangingIndent, pos, endPos-pos, false)
+		pos = endPos
+	}
+
+	// Lay out the Note (if visible) beneath the Headline text
+	if h.Note != nil && h.ShowNote {
+		e.layoutNote(h, key.level, key.hangingIndent+noteIndent, key.noteMarkers)
+	}
+	e.layouts[h] = &headlineLayout{key, append([]*line(nil), e.lineIndex[first:]...)}
+	return len(e.lineIndex) - first
+}
+
+// Lay out the current Headline again after its text (or its Note) was edited, when nothing else in the outline
+//  can have changed.  Its new lines replace its old ones in lineIndex, the rest of the outline is left alone.
+//  Returns false if the whole outline needs laying out instead.
+func (e *editor) layoutCurrent() bool {
+	h := e.out.headlineIndex[e.currentHeadlineID]
+	cached, found := e.layouts[h]
+	if e.laidOut != e.out || h == nil || !found || cached.key.width != e.editorWidth {
+		return false
+	}
+	if e.markersIn != nil && e.markersIn != h {
+		return false // the Headline we left has to be laid out again without its markers
+	}
+	key := cached.key
+	key.textVersion = h.Buf.Version()
+	key.noteVersion = 0
+	if h.Note != nil && h.ShowNote {
+		key.noteVersion = h.Note.Version()
+	}
+	key.textMarkers, key.noteMarkers = e.markersShown(h)
+	e.markersIn = nil
+	if key.textMarkers || key.noteMarkers {
+		e.markersIn = h
+	}
+	if key == cached.key {
+		return true // nothing has changed
+	}
+	// Find the Headline's lines (the cursor was on one of them before the edit)
+	first := e.linePtr
+	if first >= len(e.lineIndex) {
+		return false
+	}
+	for first > 0 && e.lineIndex[first-1].headlineID == h.ID {
+		first--
+	}
+	n := len(cached.lines)
+	if first+n > len(e.lineIndex) || e.lineIndex[first] != cached.lines[0] || e.lineIndex[first+n-1] != cached.lines[n-1] {
+		return false
+	}
+	tail := append([]*line(nil), e.lineIndex[first+n:]...)
+	e.lineIndex = e.lineIndex[:first]
+	e.layoutText(h, key)
+	e.lineIndex = append(e.lineIndex, tail...)
+	return true
+}
+
+// Format a Headline's Note.  Each line of the Note (ending in a newline) is word-wrapped separately.
+//  The newline itself is included at the end of its logical line so the cursor has somewhere to sit.
+func (e *editor) layoutNote(h *Headline, level int, indent int, showMarkers bool) {
+	width := e.editorWidth - (level * 3) - 2 - noteIndent
+	var hidden []span
+	if !showMarkers {
+		hidden = findFormatting(h.Note)
+	}
+	pos := 0
+	it := h.Note.Iterator(0)
+	for pos < h.Note.Len() {
+		// Find the end of this line of the Note (including the newline or trailing nodeDelim)
+		for r, ok := it.Next(); ok && r != '\n'; r, ok = it.Next() {
+		}
+		eol := it.Position()
+		for pos < eol {
+			endPos := fitWidth(h.Note, pos, eol, width, hidden)
+			if endPos < eol {
+				endPos = wordWrap(h.Note, pos, endPos)
+			}
+			e.recordLogicalLine(h.ID, 0, indent, indent, pos, endPos-pos, true)
+			pos = endPos
+		}
+	}
+}
+
+// Find where to end a line of text that runs from pos up to (at most) endPos so we don't split a word.  endPos
+//  is always the start of a grapheme cluster (see fitWidth), and so is the position after a space.  If
+//  the rune at endPos isn't whitespace, walk backwards to the first whitespace and end the line just after it.
+func wordWrap(buf *PieceTable, pos int, endPos int) int {
+	if endPos >= buf.Len() || unicode.IsSpace(buf.RuneAt(endPos)) {
+		return endPos
+	}
+	it := buf.Iterator(endPos + 1)
+	for p := endPos; p > pos; p-- {
+		if r, _ := it.Prev(); unicode.IsSpace(r) {
+			return p + 1 // split at the space
+		}
+	}
+	return endPos // hitting pos means beginning of text or last starting point, so we have to split the word
+}
+
 // Walk thru the lineIndex and render each logical line that is within the window's boundaries
-func (e *editor) renderOutline(s tcell.Screen) {
+//  Returns where the URLs were drawn so they can be made into hyperlinks.
+func (e *editor) renderOutline(s tcell.Screen) []hyperlink {
 	y := 1
 	lastLine := ed.topLine + ed.editorHeight - 1
+	var links []link
+	var urls []webLink
+	var hyperlinks []hyperlink
+	var spans []span
+	var linksFor *PieceTable // which buffer we found links (and formatting) for
 	for l := ed.topLine; l <= lastLine && l < len(ed.lineIndex); l++ {
 		x := 0
 		line := ed.lineIndex[l]
 		h := ed.out.headlineIndex[line.headlineID]
-		runes := (*h.Buf.Runes())
+		buf := &h.Buf
+		textStyle := defStyle
+		if line.note {
+			buf = h.Note
+			textStyle = noteStyle
+		}
+		if buf != linksFor { // links may wrap across lines, so find them for the whole buffer
+			links = findLinks(buf)
+			urls = findURLs(buf)
+			spans = findFormatting(buf)
+			linksFor = buf
+		}
+		showMarkers := ed.showsMarkers(line.headlineID, line.note)
+		it := buf.Iterator(line.position)
 		s.SetContent(x+line.indent, y, line.bullet, nil, defStyle)
-		for p := line.position; p < line.position+line.length; p++ {
+		end := line.position + line.length
+		for p := line.position; p < end; {
+			cluster := nextCluster(it, end)
+			next := p + len(cluster)
 			// If we're rendering the current position, place cursor here, remember this is current logical line
-			if line.headlineID == ed.currentHeadlineID && ed.currentPosition == p {
+			if line.headlineID == ed.currentHeadlineID && line.note == ed.inNote && ed.currentPosition >= p && ed.currentPosition < next {
 				cursX = line.hangingIndent + x
 				cursY = y
 				ed.linePtr = l
 			}
 			// Set the style depending on whether we're selecting or not
-			theStyle := defStyle
-			if ed.isSelecting() && line.headlineID == ed.sel.headlineID && p >= ed.sel.startPosition && p <= ed.sel.endPosition {
+			theStyle := textStyle
+			u, isURL := urlAt(urls, p)
+			if isURL || inLink(links, p) {
+				theStyle = linkStyle
+			}
+			format, isMarker := formatAt(spans, p)
+			theStyle = format.apply(theStyle)
+			if ed.isSelecting() && line.headlineID == ed.sel.headlineID && line.note == ed.inNote &&
+				p >= ed.sel.startPosition && p <= ed.sel.endPosition {
 				theStyle = selectedStyle
 			}
-			s.SetContent(x+line.hangingIndent, y, runes[p], nil, theStyle)
-			x++
+			r := cluster[0]
+			if isMarker && !showMarkers { // markers take no space unless we're editing this text
+				p = next
+				continue
+			}
+			if r == '\n' {
+				r = ' '
+			} else if r == nodeDelim && !line.note && h.Note != nil && !h.ShowNote && !h.noteIsEmpty() {
+				r = ellipsis // let the user know there is a hidden Note
+				theStyle = noteStyle
+			}
+			s.SetContent(x+line.hangingIndent, y, r, cluster[1:], theStyle)
+			if isURL {
+				hyperlinks = addHyperlink(hyperlinks, x+line.hangingIndent, y, cluster, u.address, theStyle)
+			}
+			x += clusterWidth(cluster)
+			p = next
 		}
 		y++
 	}
+	return hyperlinks
 }
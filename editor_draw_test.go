@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// an outline with n top level Headlines, each with a few children
+func bigOutline(n int) *Outline {
+	o := newOutline("Big")
+	text := strings.Repeat("some words to wrap ", 8)
+	for i := 0; i < n; i++ {
+		id, _ := o.addHeadline(fmt.Sprintf("Headline %d %s", i, text), -1)
+		for c := 0; c < 3; c++ {
+			o.addHeadline(fmt.Sprintf("Child %d", c), id)
+		}
+	}
+	return o
+}
+
+// where each line is, one per line of text
+func lineSummary(lines []*line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		fmt.Fprintf(&b, "%d %d %d %c %v\n", l.headlineID, l.position, l.length, l.bullet, l.note)
+	}
+	return b.String()
+}
+
+func layoutEditor(o *Outline) *editor {
+	return &editor{org: &organizer{}, out: o, editorWidth: 60, editorHeight: 40}
+}
+
+func TestIncrementalLayout(t *testing.T) {
+
+	o := testOutline()
+	e := layoutEditor(o)
+	e.layoutOutline(nil)
+	lines := len(e.lineIndex)
+
+	fmt.Println("Unchanged Headlines reuse their lines")
+	first := e.lineIndex[0]
+	e.layoutOutline(nil)
+	if e.lineIndex[0] != first || len(e.lineIndex) != lines {
+		t.Errorf("Fail: relayout of an unchanged outline built new lines\n")
+	}
+
+	fmt.Println("Edited Headlines are laid out again")
+	h := o.headlineIndex[1]
+	h.Buf.Insert(0, strings.Repeat("long ", 20))
+	e.layoutOutline(nil)
+	if e.lineIndex[0] == first || len(e.lineIndex) <= lines {
+		t.Errorf("Fail: edited Headline wanted more lines than %d got %d\n", lines, len(e.lineIndex))
+	}
+
+	fmt.Println("Undo lays out again too")
+	h.Buf.Undo()
+	e.layoutOutline(nil)
+	if len(e.lineIndex) != lines {
+		t.Errorf("Fail: after undo wanted %d lines got %d\n", lines, len(e.lineIndex))
+	}
+
+	fmt.Println("Only the current Headline is laid out again after an edit")
+	e.currentHeadlineID = 4 // B
+	e.scrollToCursor()
+	b := o.headlineIndex[4]
+	b.Buf.Insert(0, strings.Repeat("long ", 20))
+	if !e.layoutCurrent() {
+		t.Fatalf("Fail: couldn't lay out just the current Headline\n")
+	}
+	spliced := lineSummary(e.lineIndex)
+	e.laidOut = nil // lay out everything from scratch to compare
+	e.layoutOutline(nil)
+	if full := lineSummary(e.lineIndex); spliced != full {
+		t.Errorf("Fail: laying out B alone got\n%s\nbut the whole outline got\n%s\n", spliced, full)
+	}
+	e.linePtr = 0 // not on B's lines any more
+	b.Buf.Undo()
+	if e.layoutCurrent() {
+		t.Errorf("Fail: B's lines can't be found from line 0\n")
+	}
+	e.layoutOutline(nil)
+
+	fmt.Println("Layouts of deleted Headlines are forgotten")
+	big := bigOutline(20)
+	e = layoutEditor(big)
+	e.layoutOutline(nil)
+	big.Headlines = big.Headlines[:2]
+	e.layoutOutline(nil)
+	if len(e.layouts) != 8 {
+		t.Errorf("Fail: wanted 8 layouts remembered got %d\n", len(e.layouts))
+	}
+	e = layoutEditor(o)
+	e.layoutOutline(nil)
+
+	fmt.Println("Visible order of Headlines")
+	o.headlineIndex[2].Expanded = false // hide i
+	e.layoutOutline(nil)
+	if p, n := o.prevNextFrom(4, e); p != 2 || n != 5 {
+		t.Errorf("Fail: around B wanted 2 and 5 got %d and %d\n", p, n)
+	}
+	if p, n := o.prevNextFrom(1, e); p != -1 || n != 2 {
+		t.Errorf("Fail: around One wanted -1 and 2 got %d and %d\n", p, n)
+	}
+	if p, n := o.prevNextFrom(3, e); p != -1 || n != -1 {
+		t.Errorf("Fail: hidden Headline wanted -1 and -1 got %d and %d\n", p, n)
+	}
+
+	fmt.Println("Hidden formatting markers take up no room")
+	o = testOutline()
+	two := o.headlineIndex[5]
+	two.Buf.Insert(0, strings.Repeat("**ab** ", 8)) // 27 columns without its markers, 59 with them
+	e = layoutEditor(o)
+	e.currentHeadlineID = 1
+	e.layoutOutline(nil)
+	linesOf := func(ID int) []int {
+		var lines []int
+		for l, line := range e.lineIndex {
+			if line.headlineID == ID {
+				lines = append(lines, l)
+			}
+		}
+		return lines
+	}
+	if lines := linesOf(5); len(lines) != 1 {
+		t.Fatalf("Fail: wanted Two on 1 line with its markers hidden got %d\n", len(lines))
+	}
+	if p := e.positionOnLine(linesOf(5)[0], 6); p != 16 {
+		t.Errorf("Fail: wanted the third ab at column 6 got position %d\n", p)
+	}
+	if col := columnOf(&two.Buf, 0, 16, e.hiddenMarkers(e.lineIndex[linesOf(5)[0]])); col != 6 {
+		t.Errorf("Fail: wanted the third ab drawn at column 6 got %d\n", col)
+	}
+	e.currentHeadlineID = 5
+	e.scrollToCursor()
+	if !e.layoutCurrent() || len(linesOf(5)) != 2 {
+		t.Errorf("Fail: wanted Two on 2 lines with its markers showing got %d\n", len(linesOf(5)))
+	}
+	e.currentHeadlineID = 1
+	if e.layoutCurrent() {
+		t.Errorf("Fail: leaving Two should lay it out again without its markers\n")
+	}
+	e.layoutOutline(nil)
+	if lines := linesOf(5); len(lines) != 1 {
+		t.Errorf("Fail: wanted Two back on 1 line got %d\n", len(lines))
+	}
+}
+
+func BenchmarkLayoutAfterEdit(b *testing.B) {
+	o := bigOutline(10000)
+	e := layoutEditor(o)
+	e.layoutOutline(nil)
+	h := o.Headlines[5000]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Buf.Insert(0, "x")
+		e.layoutOutline(nil)
+	}
+}
+
+func BenchmarkLayoutCurrentAfterEdit(b *testing.B) {
+	o := bigOutline(10000)
+	e := layoutEditor(o)
+	h := o.Headlines[5000]
+	e.currentHeadlineID = h.ID
+	e.layoutOutline(nil)
+	e.scrollToCursor()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Buf.Insert(0, "x")
+		if !e.layoutCurrent() {
+			b.Fatal("full layout needed")
+		}
+	}
+}
+
+func BenchmarkLayoutFromScratch(b *testing.B) {
+	o := bigOutline(10000)
+	e := layoutEditor(o)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.laidOut = nil // forget every cached layout
+		e.layoutOutline(nil)
+	}
+}
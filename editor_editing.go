@@ -1,6 +1,8 @@
 package main
 
 import (
+	"strings"
+
 	"github.com/gdamore/tcell/v2"
 )
 
@@ -16,21 +18,34 @@ func (e *editor) setDirty(s tcell.Screen, dirty bool) {
 }
 
 func (e *editor) insertRuneAtCurrentPosition(o *Outline, r rune) {
-	h := o.currentHeadline(e)
-	h.Buf.InsertRunes(e.currentPosition, []rune{r})
+	e.currentBuf().InsertRunes(e.currentPosition, []rune{r})
 	e.moveRight(false)
 }
 
 // Remove the previous character.  Join this Headline to the previous Headline if on first character
 func (e *editor) backspace(o *Outline) {
+	if e.inNote { // Within a Note we never join Headlines
+		h := o.currentHeadline(e)
+		if e.currentPosition > 0 {
+			start := prevClusterStart(h.Note, e.currentPosition)
+			h.Note.Delete(start, e.currentPosition-start)
+			e.currentPosition = start
+		} else if h.noteIsEmpty() { // backspacing out of an empty Note removes it
+			h.Note = nil
+			h.ShowNote = false
+			e.inNote = false
+			e.currentPosition = h.Buf.lastpos - 1
+		}
+		return
+	}
 	if e.currentPosition == 0 && e.linePtr == 0 { // Do nothing if on first character of first headline
 		return
 	} else {
 		currentHeadline := o.currentHeadline(e)
-		if e.currentPosition > 0 { // Remove previous character
-			posToRemove := e.currentPosition - 1
-			currentHeadline.Buf.Delete(posToRemove, 1)
-			e.moveLeft(false)
+		if e.currentPosition > 0 { // Remove previous character (all of the runes that make it up)
+			posToRemove := prevClusterStart(&currentHeadline.Buf, e.currentPosition)
+			currentHeadline.Buf.Delete(posToRemove, e.currentPosition-posToRemove)
+			e.currentPosition = posToRemove
 		} else { // Join this headline with previous one
 			previousHeadline := o.previousHeadline(currentHeadline.ID, e)
 			if previousHeadline != nil {
@@ -39,6 +54,8 @@ func (e *editor) backspace(o *Outline) {
 				e.currentPosition = previousHeadline.Buf.lastpos - 1
 				previousHeadline.Buf.Delete(previousHeadline.Buf.lastpos-1, 1) // remove trailing nodeDelim
 				previousHeadline.Buf.Append(currentHeadline.Buf.Text())
+				previousHeadline.takeNoteFrom(currentHeadline)
+				forgetHistory(previousHeadline)
 				// If I have children, add them as children of the previous Headline
 				for i, c := range currentHeadline.Children {
 					insertSibling(&previousHeadline.Children, i, c)
@@ -47,7 +64,8 @@ func (e *editor) backspace(o *Outline) {
 				// Remove me from my parent and make previous Headline the current one
 				_, children := o.childrenSliceFor(currentHeadline.ID)
 				o.removeChildFrom(children, currentHeadline.ID)
-				e.moveUp()
+				e.totals.remove(currentHeadline, false)
+				e.currentHeadlineID = previousHeadline.ID
 			}
 		}
 	}
@@ -56,14 +74,24 @@ func (e *editor) backspace(o *Outline) {
 // delete the character underneath the cursor.  Join the next headline to this one if on last character of headline.
 func (e *editor) delete(o *Outline) {
 	currentHeadline := o.currentHeadline(e)
-	if e.currentPosition != currentHeadline.Buf.lastpos-1 { // Just delete the current position
-		currentHeadline.Buf.Delete(e.currentPosition, 1)
+	if e.inNote { // Within a Note we never join Headlines
+		if e.currentPosition != currentHeadline.Note.lastpos-1 {
+			end := nextClusterStart(currentHeadline.Note, e.currentPosition)
+			currentHeadline.Note.Delete(e.currentPosition, end-e.currentPosition)
+		}
+		return
+	}
+	if e.currentPosition != currentHeadline.Buf.lastpos-1 { // Just delete the current character (all of its runes)
+		end := nextClusterStart(&currentHeadline.Buf, e.currentPosition)
+		currentHeadline.Buf.Delete(e.currentPosition, end-e.currentPosition)
 	} else { // Join the next Headline onto this one
 		nextHeadline := o.nextHeadline(currentHeadline.ID, e)
 		if nextHeadline != nil {
 			// Add text from next Headline onto my own, add their children as mine
 			currentHeadline.Buf.Delete(e.currentPosition, 1) // remove my trailing nodeDelim
 			currentHeadline.Buf.Append(nextHeadline.Buf.Text())
+			currentHeadline.takeNoteFrom(nextHeadline)
+			forgetHistory(currentHeadline)
 			// If next Headline has children, make them my own
 			for i, c := range nextHeadline.Children {
 				insertSibling(&currentHeadline.Children, i, c)
@@ -72,6 +100,7 @@ func (e *editor) delete(o *Outline) {
 			// Remove next Headline from its parent
 			_, children := o.childrenSliceFor(nextHeadline.ID)
 			o.removeChildFrom(children, nextHeadline.ID)
+			e.totals.remove(nextHeadline, false)
 		}
 	}
 }
@@ -83,6 +112,10 @@ Split the current Headline's text at the cursor point.  Put all text from cursor
 new Headline that is the next sibling of current Headline.
 */
 func (e *editor) enterPressed(o *Outline) {
+	if e.inNote { // Enter within a Note just starts a new line of the Note
+		e.insertRuneAtCurrentPosition(o, '\n')
+		return
+	}
 	currentHeadline := o.currentHeadline(e)
 
 	// If the Headlne has children and is collapsed, just move cursor down to next line instead, we can't add children now
@@ -93,9 +126,9 @@ func (e *editor) enterPressed(o *Outline) {
 	}
 
 	// "Split" current Headline at cursor position and create a new Headline with remaining text
-	text := (*currentHeadline.Buf.Runes())
-	newText := text[e.currentPosition : len(text)-1] // Extract remaining text (except trailing nodeDelim)
+	newText := currentHeadline.Buf.Slice(e.currentPosition, currentHeadline.Buf.Len()-1) // Extract remaining text (except trailing nodeDelim)
 	currentHeadline.Buf.Delete(e.currentPosition, len(newText))
+	currentHeadline.Buf.ClearHistory()
 	newHeadline := o.newHeadline(string(newText), currentHeadline.ParentID)
 
 	// Where to put the new Headline?  If we have children, make it first child.  Otherwise it should
@@ -111,6 +144,8 @@ func (e *editor) enterPressed(o *Outline) {
 
 	// Update the o.HeadlinesIndex
 	o.headlineIndex[newHeadline.ID] = newHeadline
+	e.totals.recount(currentHeadline) // we're about to leave it, with some of its text gone
+	e.totals.add(newHeadline)
 	e.currentHeadlineID = newHeadline.ID
 	e.currentPosition = 0
 
@@ -123,7 +158,7 @@ func (e *editor) enterPressed(o *Outline) {
 
 //  Promote a Headline further down the outline one level
 func (e *editor) tabPressed(o *Outline) {
-	if e.linePtr != 0 {
+	if e.linePtr != 0 && !e.inNote {
 		currentHeadline := o.currentHeadline(e)
 		previousHeadline := o.previousHeadline(e.currentHeadlineID, e)
 		if currentHeadline.ParentID != previousHeadline.ID { // Are we already "promoted"?
@@ -144,7 +179,7 @@ func (e *editor) tabPressed(o *Outline) {
 
 //  "Demote" a Headline back up the outline one level
 func (e *editor) backTabPressed(o *Outline) {
-	if e.linePtr != 0 {
+	if e.linePtr != 0 && !e.inNote {
 		currentHeadline := o.currentHeadline(e)
 		//previousHeadline := o.previousHeadline(o.currentHeadlineID)
 		if currentHeadline.ParentID != -1 { // it is possible to demote us
@@ -177,60 +212,245 @@ func (e *editor) deleteHeadline(o *Outline) {
 		// Simply remove the Headline reference from our parent's children, keep in the index (so we can support Undo eventually)
 		_, children := o.childrenSliceFor(h.ID)
 		o.removeChildFrom(children, h.ID)
+		e.totals.remove(h, true)
 		e.currentHeadlineID = p.ID
 		e.currentPosition = 0
 	} else { // delete all text in first headline if it's the only one left
 		h.Buf.Delete(0, h.Buf.lastpos-1)
+		h.Note = nil
+		h.ShowNote = false
 		e.currentPosition = 0
 	}
+	e.inNote = false
 }
 
 // copy the current Headline to the clipboard
 func (e *editor) copyHeadline() {
-
+	h := e.out.currentHeadline(e)
+	e.headlineClipboard = h.snapshot() // IDs are given out when it is pasted
+	e.headlineCut = false
+	e.selectionClipboard = nil
+	e.copyToSystemClipboard(h.clipboardText(cfg[clipboardFormatCfgKey] == "markdown"))
 }
 
 // cut the current Headline and put in the clipboard
 func (e *editor) cutHeadline() {
+	h := e.out.currentHeadline(e)
+	// Move to a Headline that will still be there once we're gone
+	target := e.out.previousHeadline(h.ID, e)
+	if target == nil {
+		target = e.nextHeadlineAfter(h)
+	}
+	if target == nil {
+		return // this Headline (and its children) is the entire outline- we always need at least one Headline
+	}
+	e.copyHeadline()
+	e.headlineCut = true
+	_, children := e.out.childrenSliceFor(h.ID)
+	e.out.removeChildFrom(children, h.ID)
+	e.totals.remove(h, true)
+	e.currentHeadlineID = target.ID
+	e.currentPosition = 0
+	e.inNote = false
+}
 
+// Find the first visible Headline after h that is not one of h's descendants
+func (e *editor) nextHeadlineAfter(h *Headline) *Headline {
+	n := e.out.nextHeadline(h.ID, e)
+	for n != nil && e.out.isDescendant(n, h) {
+		n = e.out.nextHeadline(n.ID, e)
+	}
+	return n
 }
 
 // copy the text of selection to the clipboard
 func (e *editor) copySelection() {
 	if e.isSelecting() {
-		buf := []rune{}
-		text := *(e.out.headlineIndex[e.currentHeadlineID].Buf.Runes())
-		for c := e.sel.startPosition; c <= e.sel.endPosition; c++ {
-			buf = append(buf, text[c])
-		}
+		buf := e.currentBuf().Slice(e.sel.startPosition, e.selectionEnd())
 		e.selectionClipboard = &buf
+		e.headlineClipboard = nil
+		e.copyToSystemClipboard(string(buf))
 	}
 }
 
+// Put text on the system clipboard too, remembering it so we can tell whether anything else has been copied
+//  since.  Not every terminal supports OSC 52, so failing to copy isn't an error- our own clipboard still works.
+func (e *editor) copyToSystemClipboard(text string) {
+	e.clipboardText = text
+	copyToClipboard(text)
+}
+
 // cut the current selection from current position and put in clipboard
 func (e *editor) cutSelection() {
 	if e.isSelecting() {
 		e.copySelection()
-		// Remove the runes within the selection from current Headline
-		// BUG: Sometimes this cuts the whole rest of the Headline...?  Also not setting e.currentPosition correctly
-		span := e.sel.endPosition - e.sel.startPosition
-		pieceTable := e.out.headlineIndex[e.currentHeadlineID].Buf
-		pieceTable.Delete(e.sel.startPosition, span)
-		if e.currentPosition == e.sel.endPosition {
-			e.currentPosition -= span
-		}
-		e.sel = nil
+		e.deleteSelection()
+	}
+}
+
+// Remove the runes within the selection from the current Headline (or Note), leaving the cursor where they were
+func (e *editor) deleteSelection() {
+	start := e.sel.startPosition
+	end := e.selectionEnd()
+	if end > e.currentBuf().Len()-1 {
+		end = e.currentBuf().Len() - 1 // never remove the trailing nodeDelim
+	}
+	if end > start {
+		e.currentBuf().Delete(start, end-start)
+	}
+	e.currentPosition = start
+	e.sel = nil
+}
+
+// Paste whatever was copied most recently.  If the system clipboard holds something other than what we last
+//  copied (it was copied in another program, or another gv), that's what gets pasted.  Otherwise it's our own
+//  clipboard, which keeps Headlines (and their Notes and children) just as they were.
+func (e *editor) paste() {
+	if text, err := readClipboard(); err == nil && text != "" && !sameClipboardText(text, e.clipboardText) {
+		e.pasteText(text)
+	} else if e.headlineClipboard != nil {
+		e.pasteHeadline()
+	} else {
+		e.pasteSelection()
 	}
 }
 
+// Is the text on the system clipboard the same as what we copied (ignoring any trailing newlines)?
+func sameClipboardText(text string, copied string) bool {
+	return strings.TrimRight(text, "\n") == strings.TrimRight(copied, "\n")
+}
+
 // paste the Headline in the clipboard as a child of current Headline
+//  The first paste after a cut is a move, so the Headlines keep their UIDs.  Otherwise we are making copies
+//  and they get new UIDs.  Either way they get new IDs since they may be going into a different outline.
 func (e *editor) pasteHeadline() {
+	if e.headlineClipboard == nil {
+		return
+	}
+	current := e.out.currentHeadline(e)
+	h := e.out.cloneHeadline(e.headlineClipboard, current.ID, e.headlineCut)
+	e.headlineCut = false
+	insertSibling(&current.Children, 0, h)
+	e.out.addHeadlineToIndex(h)
+	e.totals.add(h)
+	current.Expanded = true
+	e.currentHeadlineID = h.ID
+	e.currentPosition = 0
+	e.inNote = false
+}
 
+// Undo the last edit to the text under the cursor (the current Headline or its Note).  Returns false if there
+//  was nothing to undo.
+func (e *editor) undo() bool {
+	position, ok := e.currentBuf().Undo()
+	if ok {
+		e.moveToEdit(position)
+	}
+	return ok
+}
+
+// Redo the last edit that was undone in the text under the cursor.  Returns false if there
+//  was nothing to redo.
+func (e *editor) redo() bool {
+	position, ok := e.currentBuf().Redo()
+	if ok {
+		e.moveToEdit(position)
+	}
+	return ok
+}
+
+// Put the cursor where an undone/redone edit happened (the text may now be shorter)
+func (e *editor) moveToEdit(position int) {
+	if last := e.currentBuf().Len() - 1; position > last {
+		position = last
+	}
+	e.currentPosition = position
+	e.sel = nil
+}
+
+// Forget the undo history of a Headline that had text moved into it from another Headline.  Undoing only our
+//  half of the move would duplicate (or lose) text, since the other Headline is gone.
+func forgetHistory(h *Headline) {
+	h.Buf.ClearHistory()
+	if h.Note != nil {
+		h.Note.ClearHistory()
+	}
 }
 
 // paste the selection in the clipboard at current cursor position in current Headline
 func (e *editor) pasteSelection() {
+	if e.selectionClipboard != nil {
+		e.pasteText(string(*e.selectionClipboard))
+	}
+}
 
+// Paste text at the cursor, replacing the selection (if any).  Several lines pasted into a Headline (rather than
+//  a Note) become Headlines of their own.
+func (e *editor) pasteText(text string) {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return
+	}
+	if !e.inNote && strings.Contains(text, "\n") {
+		if e.isSelecting() {
+			e.deleteSelection()
+		}
+		e.pasteHeadlines(text)
+		return
+	}
+	buf := e.currentBuf()
+	runes := []rune(text)
+	buf.BeginGroup()
+	if e.isSelecting() {
+		e.deleteSelection()
+	}
+	buf.InsertRunes(e.currentPosition, runes)
+	buf.EndGroup()
+	e.currentPosition += len(runes)
+}
+
+// Turn each line of text into a Headline (indented lines become children) and add them after the current Headline
+func (e *editor) pasteHeadlines(text string) {
+	headlines := e.out.headlinesFromText(text)
+	if len(headlines) == 0 {
+		return
+	}
+	current := e.out.currentHeadline(e)
+	e.totals.recount(current) // we're about to leave it, and the selection may have been deleted from it
+	i, siblings := e.out.childrenSliceFor(current.ID)
+	for _, h := range headlines {
+		i++
+		h.ParentID = current.ParentID
+		insertSibling(siblings, i, h)
+		e.out.addHeadlineToIndex(h)
+		e.totals.add(h)
+	}
+	e.currentHeadlineID = headlines[0].ID
+	e.currentPosition = 0
+	e.inNote = false
+	e.sel = nil
+}
+
+// Show the current Headline's Note (creating an empty one if needed) or hide it if it is showing
+func (e *editor) toggleNote() {
+	h := e.out.currentHeadline(e)
+	if h.Note == nil || !h.ShowNote {
+		h.addNote()
+		if h.noteIsEmpty() { // a brand new Note- put the cursor there so we can start typing
+			e.inNote = true
+			e.currentPosition = 0
+		}
+	} else {
+		h.ShowNote = false
+		if h.noteIsEmpty() {
+			h.Note = nil
+		}
+		if e.inNote {
+			e.inNote = false
+			e.currentPosition = h.Buf.lastpos - 1
+		}
+	}
+	e.sel = nil
 }
 
 // Edit the current outline's Title
@@ -10,14 +10,19 @@ Navigation methods for the editor.
 func (e *editor) moveRight(shiftPressed bool) {
 	origPosition := e.currentPosition
 	previousHeadlineID := e.currentHeadlineID
-	if e.currentPosition < e.out.headlineIndex[e.currentHeadlineID].Buf.lastpos-1 { // are we within the text of current Headline?
-		e.currentPosition++
-	} else { // move to the first character of next Headline (if one exists and we are not selecting)
+	previousInNote := e.inNote
+	if e.currentPosition < e.currentBuf().lastpos-1 { // are we within the text of current Headline (or Note)?
+		e.currentPosition = nextClusterStart(e.currentBuf(), e.currentPosition)
+	} else { // move to the first character of the Note or next Headline (if one exists and we are not selecting)
 		if !shiftPressed {
-			h := e.out.nextHeadline(e.currentHeadlineID, e)
-			if h != nil {
+			current := e.out.currentHeadline(e)
+			if !e.inNote && current.Note != nil && current.ShowNote {
+				e.inNote = true
+				e.currentPosition = 0
+			} else if h := e.out.nextHeadline(e.currentHeadlineID, e); h != nil {
 				e.currentHeadlineID = h.ID
 				e.currentPosition = 0
+				e.inNote = false
 			} else { // no more Headlines
 				return
 			}
@@ -44,7 +49,7 @@ func (e *editor) moveRight(shiftPressed bool) {
 	newPtr := e.linePtr + 1
 	if newPtr < len(e.lineIndex) { // we have additional logical lines beneath us
 		if e.linePtr-e.topLine+1 >= e.editorHeight { // we are on last row of editor window
-			if e.currentHeadlineID == previousHeadlineID { // we are on same Headline
+			if e.currentHeadlineID == previousHeadlineID && e.inNote == previousInNote { // we are on same Headline
 				if e.currentPosition >= e.lineIndex[newPtr].position { // We've 'moved' to next logical line
 					e.topLine++
 				}
@@ -62,14 +67,22 @@ func (e *editor) moveLeft(shiftPressed bool) {
 	} else {
 		origPosition := e.currentPosition
 		previousHeadlineID := e.currentHeadlineID
+		previousInNote := e.inNote
 		if e.currentPosition > 0 { // Just move to previous character in this headline
-			e.currentPosition--
-		} else { // at first character of current headline, move to end of previous headline
+			e.currentPosition = prevClusterStart(e.currentBuf(), e.currentPosition)
+		} else { // at first character of current headline, move to end of previous headline (or out of the Note)
 			if !shiftPressed {
-				p := e.out.previousHeadline(e.currentHeadlineID, e)
-				if p != nil {
+				if e.inNote {
+					e.inNote = false
+					e.currentPosition = e.out.currentHeadline(e).Buf.lastpos - 1
+				} else if p := e.out.previousHeadline(e.currentHeadlineID, e); p != nil {
 					e.currentHeadlineID = p.ID
-					e.currentPosition = p.Buf.lastpos - 1
+					if p.Note != nil && p.ShowNote {
+						e.inNote = true
+						e.currentPosition = p.Note.lastpos - 1
+					} else {
+						e.currentPosition = p.Buf.lastpos - 1
+					}
 				}
 			} else { // We are selecting, so do nothing
 				return
@@ -94,7 +107,7 @@ func (e *editor) moveLeft(shiftPressed bool) {
 		newPtr := e.linePtr - 1
 		if newPtr >= 0 {
 			if e.linePtr-e.topLine+1 == 1 { // we are on first row of editor window
-				if e.currentHeadlineID == previousHeadlineID { // we are on same Headline
+				if e.currentHeadlineID == previousHeadlineID && e.inNote == previousInNote { // we are on same Headline
 					if e.currentPosition <= e.lineIndex[newPtr].position+e.lineIndex[newPtr].length { // We've 'moved' to previous logical line
 						e.topLine--
 					}
@@ -109,15 +122,12 @@ func (e *editor) moveLeft(shiftPressed bool) {
 func (e *editor) moveDown() bool {
 	if e.linePtr != len(e.lineIndex)-1 { // Make sure we're not on last line
 		e.sel = nil
-		offset := e.currentPosition - e.lineIndex[e.linePtr].position // how far 'in' are we on the logical line?
+		column := e.cursorColumn() // how far 'in' are we on the logical line?
 		newLinePtr := e.linePtr + 1
 		if newLinePtr < len(e.lineIndex) { // There are more lines below us
-			if offset >= e.lineIndex[newLinePtr].length { // Are we moving down to a smaller line with x too far right?
-				e.currentPosition = e.lineIndex[newLinePtr].position + e.lineIndex[newLinePtr].length - 1
-			} else {
-				e.currentPosition = offset + e.lineIndex[newLinePtr].position
-			}
+			e.currentPosition = e.positionOnLine(newLinePtr, column) // (or its last character if the line is shorter)
 			e.currentHeadlineID = e.lineIndex[newLinePtr].headlineID // pick up this logical line's headlineID just in case we move to a new Headline
+			e.inNote = e.lineIndex[newLinePtr].note
 		}
 		// Scroll?
 		if e.linePtr-e.topLine+1 >= e.editorHeight {
@@ -130,18 +140,14 @@ func (e *editor) moveDown() bool {
 
 func (e *editor) selectDown() bool {
 	if e.linePtr != len(e.lineIndex)-1 { // Make sure we're not on last line
-		offset := e.currentPosition - e.lineIndex[e.linePtr].position // how far 'in' are we on the logical line?
+		column := e.cursorColumn() // how far 'in' are we on the logical line?
 		newLinePtr := e.linePtr + 1
 		if !e.isSelecting() {
 			e.sel = &selection{e.currentHeadlineID, e.currentPosition, 0}
 		}
 		if newLinePtr < len(e.lineIndex) { // There are more lines below us
-			if e.sel.headlineID == e.lineIndex[newLinePtr].headlineID { // Make sure we're not moving to a new Headline
-				if offset >= e.lineIndex[newLinePtr].length { // Are we moving down to a smaller line with x too far right?
-					e.currentPosition = e.lineIndex[newLinePtr].position + e.lineIndex[newLinePtr].length - 1
-				} else {
-					e.currentPosition = offset + e.lineIndex[newLinePtr].position
-				}
+			if e.sel.headlineID == e.lineIndex[newLinePtr].headlineID && e.lineIndex[newLinePtr].note == e.inNote { // Make sure we're not moving to a new Headline
+				e.currentPosition = e.positionOnLine(newLinePtr, column) // (or its last character if the line is shorter)
 			} else { // moving down would put us on a new Headline, do nothing
 				return false
 			}
@@ -156,6 +162,35 @@ func (e *editor) selectDown() bool {
 	return false
 }
 
+// the screen column of the cursor within its logical line
+func (e *editor) cursorColumn() int {
+	line := e.lineIndex[e.linePtr]
+	return columnOf(e.bufferFor(line), line.position, e.currentPosition, e.hiddenMarkers(line))
+}
+
+// the position on logical line l that is displayed at column col
+func (e *editor) positionOnLine(l int, col int) int {
+	line := e.lineIndex[l]
+	return positionAtColumn(e.bufferFor(line), line.position, line.position+line.length, col, e.hiddenMarkers(line))
+}
+
+// the formatting whose markers aren't shown on a logical line (nil if they are), so we know where its text is drawn
+func (e *editor) hiddenMarkers(line *line) []span {
+	if e.showsMarkers(line.headlineID, line.note) {
+		return nil
+	}
+	return findFormatting(e.bufferFor(line))
+}
+
+// the text a logical line shows- either a Headline's text or its Note
+func (e *editor) bufferFor(line *line) *PieceTable {
+	h := e.out.headlineIndex[line.headlineID]
+	if line.note {
+		return h.Note
+	}
+	return &h.Buf
+}
+
 func (e *editor) pageDown() {
 	if (e.topLine + e.editorHeight) < len(e.lineIndex) { // Make sure we have at least a "page" beneath us
 		e.linePtr += e.editorHeight
@@ -164,6 +199,7 @@ func (e *editor) pageDown() {
 		}
 		e.currentPosition = e.lineIndex[e.linePtr].position
 		e.currentHeadlineID = e.lineIndex[e.linePtr].headlineID
+		e.inNote = e.lineIndex[e.linePtr].note
 		e.topLine += e.editorHeight
 		if e.topLine >= len(e.lineIndex) {
 			e.topLine = len(e.lineIndex) - e.editorHeight
@@ -173,16 +209,13 @@ func (e *editor) pageDown() {
 
 func (e *editor) moveUp() {
 	if e.linePtr != 0 { // Do nothing if on first logical line
-		offset := e.currentPosition - e.lineIndex[e.linePtr].position // how far 'in' are we on the logical line?
+		column := e.cursorColumn() // how far 'in' are we on the logical line?
 		newLinePtr := e.linePtr - 1
 		e.sel = nil
 		if newLinePtr >= 0 { // There are more lines above
-			if offset >= e.lineIndex[newLinePtr].length { // Are we moving up to a smaller line with x too far right?
-				e.currentPosition = e.lineIndex[newLinePtr].position + e.lineIndex[newLinePtr].length - 1
-			} else {
-				e.currentPosition = offset + e.lineIndex[newLinePtr].position
-			}
+			e.currentPosition = e.positionOnLine(newLinePtr, column) // (or its last character if the line is shorter)
 			e.currentHeadlineID = e.lineIndex[newLinePtr].headlineID // pick up this logical line's headlineID just in case we move to a new Headline
+			e.inNote = e.lineIndex[newLinePtr].note
 		}
 		// Scroll?
 		if e.linePtr != 0 && e.linePtr-e.topLine+1 == 1 {
@@ -193,18 +226,14 @@ func (e *editor) moveUp() {
 
 func (e *editor) selectUp() {
 	if e.linePtr != 0 { // Do nothing if on first logical line
-		offset := e.currentPosition - e.lineIndex[e.linePtr].position // how far 'in' are we on the logical line?
+		column := e.cursorColumn() // how far 'in' are we on the logical line?
 		newLinePtr := e.linePtr - 1
 		if !e.isSelecting() {
 			e.sel = &selection{e.currentHeadlineID, 0, e.currentPosition}
 		}
 		if newLinePtr >= 0 { // There are more lines above
-			if e.sel.headlineID == e.lineIndex[newLinePtr].headlineID { // Make sure we're not moving to a new Headline
-				if offset >= e.lineIndex[newLinePtr].length { // Are we moving up to a smaller line with x too far right?
-					e.currentPosition = e.lineIndex[newLinePtr].position + e.lineIndex[newLinePtr].length - 1
-				} else {
-					e.currentPosition = offset + e.lineIndex[newLinePtr].position
-				}
+			if e.sel.headlineID == e.lineIndex[newLinePtr].headlineID && e.lineIndex[newLinePtr].note == e.inNote { // Make sure we're not moving to a new Headline
+				e.currentPosition = e.positionOnLine(newLinePtr, column) // (or its last character if the line is shorter)
 			} else { // moving down would put us on a new Headline, do nothing
 				return
 			}
@@ -224,6 +253,7 @@ func (e *editor) pageUp() {
 	}
 	e.currentPosition = e.lineIndex[e.linePtr].position
 	e.currentHeadlineID = e.lineIndex[e.linePtr].headlineID
+	e.inNote = e.lineIndex[e.linePtr].note
 	e.topLine -= e.editorHeight
 	if e.topLine < 0 {
 		e.topLine = 0
@@ -246,7 +276,7 @@ func (e *editor) moveHome(shiftPressed bool) {
 
 func (e *editor) moveEnd(shiftPressed bool) {
 	origPosition := e.currentPosition
-	e.currentPosition = e.out.headlineIndex[e.currentHeadlineID].Buf.lastpos - 1
+	e.currentPosition = e.currentBuf().lastpos - 1
 	if shiftPressed {
 		if !e.isSelecting() {
 			e.sel = &selection{e.currentHeadlineID, origPosition, e.currentPosition - 1} // omit nodeDelim at end of Headline
@@ -257,3 +287,48 @@ func (e *editor) moveEnd(shiftPressed bool) {
 		e.sel = nil
 	}
 }
+
+// After folding, the Headline under the cursor may have been hidden.  Move the cursor to the Headline
+//  that is displayed in its place.
+func (e *editor) keepCursorVisible() {
+	h := e.out.visibleAncestor(e.currentHeadlineID)
+	if h.ID != e.currentHeadlineID {
+		e.currentHeadlineID = h.ID
+		e.currentPosition = 0
+		e.inNote = false
+		e.sel = nil
+	}
+}
+
+// Is the cursor on line l of lineIndex?
+func (e *editor) isCursorLine(l int) bool {
+	line := e.lineIndex[l]
+	return line.headlineID == e.currentHeadlineID && line.note == e.inNote &&
+		e.currentPosition >= line.position && e.currentPosition < line.position+line.length
+}
+
+// Find the logical line beneath the cursor and scroll so it is within the editor window
+func (e *editor) scrollToCursor() {
+	// The cursor is usually on (or near) the line it was on last time, so look there first and work outwards
+	if e.linePtr >= len(e.lineIndex) {
+		e.linePtr = len(e.lineIndex) - 1
+	}
+	if e.linePtr < 0 {
+		e.linePtr = 0
+	}
+	for d := 0; d < len(e.lineIndex); d++ {
+		if l := e.linePtr - d; l >= 0 && l < len(e.lineIndex) && e.isCursorLine(l) {
+			e.linePtr = l
+			break
+		}
+		if l := e.linePtr + d; l >= 0 && l < len(e.lineIndex) && e.isCursorLine(l) {
+			e.linePtr = l
+			break
+		}
+	}
+	if e.linePtr < e.topLine {
+		e.topLine = e.linePtr
+	} else if e.linePtr >= e.topLine+e.editorHeight {
+		e.topLine = e.linePtr - e.editorHeight + 1
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+Editing Folders (and moving outlines) in the Organizer.
+
+A Folder's directory name never changes- the name we show comes from its metadata in the FolderIndex, so renaming a
+Folder (CTRL-R) only changes the index.  CTRL-E edits the rest of a Folder's metadata: a description shown after its
+name, a color (one of the tcell color names) and an icon shown in front of it.
+
+CTRL-T moves the selected Folder or outline into another Folder.  The Organizer lists every Folder it could go to,
+and ENTER picks one.  Moving a Folder moves everything inside it, so every FolderIndex key beneath it is rewritten.
+
+*/
+
+// The FolderIndex key for a Folder's directory (keys are relative to the base directory)
+func (org *organizer) folderKey(dir string) string {
+	return strings.TrimPrefix(filepath.Clean(dir), org.baseDir)
+}
+
+// The metadata for the Folder in dir.  Directories created outside of gv aren't in the index yet, so they are
+//  added (named after their directory).
+func (org *organizer) folderFor(dir string) *Folder {
+	key := org.folderKey(dir)
+	folder, found := (*org.folderIndex)[key]
+	if !found {
+		folder = &Folder{Name: filepath.Base(dir)}
+		(*org.folderIndex)[key] = folder
+		org.saveFolderIndex()
+	}
+	return folder
+}
+
+// Rewrite the keys of the Folder at key from (and everything beneath it) to start with to instead
+func (fi FolderIndex) move(from string, to string) {
+	for key, folder := range fi {
+		if key == from || strings.HasPrefix(key, from+string(filepath.Separator)) {
+			delete(fi, key)
+			fi[to+strings.TrimPrefix(key, from)] = folder
+		}
+	}
+}
+
+// Forget the Folder at key and everything beneath it
+func (fi FolderIndex) remove(key string) {
+	for k := range fi {
+		if k == key || strings.HasPrefix(k, key+string(filepath.Separator)) {
+			delete(fi, k)
+		}
+	}
+}
+
+// Change the name shown for the selected Folder
+func (org *organizer) renameSelected(s tcell.Screen) {
+	entry := org.entries[org.currentLine]
+	if entry.folder == nil {
+		return // an outline (its title is edited in the Editor) or ".."
+	}
+	name, ok := editPrompt(s, "Folder name: ", entry.folder.Name)
+	if !ok || strings.TrimSpace(name) == "" {
+		return
+	}
+	entry.folder.Name = strings.TrimSpace(name)
+	org.saveFolderIndex()
+	org.refresh(s)
+}
+
+// Edit the description, color and icon of the selected Folder
+func (org *organizer) editSelected(s tcell.Screen) {
+	entry := org.entries[org.currentLine]
+	if entry.folder == nil {
+		return
+	}
+	f := *entry.folder
+	var ok bool
+	if f.Description, ok = editPrompt(s, "Description: ", f.Description); !ok {
+		return
+	}
+	for {
+		if f.Color, ok = editPrompt(s, "Color (a color name, or blank for the default): ", f.Color); !ok {
+			return
+		}
+		if _, found := tcell.ColorNames[f.Color]; found || f.Color == "" {
+			break
+		}
+		prompt(s, fmt.Sprintf("%s is not a color name", f.Color))
+	}
+	if f.Icon, ok = editPrompt(s, "Icon: ", f.Icon); !ok {
+		return
+	}
+	f.Description = strings.TrimSpace(f.Description)
+	f.Icon = strings.TrimSpace(f.Icon)
+	*entry.folder = f
+	org.saveFolderIndex()
+	org.refresh(s)
+}
+
+// List the Folders the selected entry could be moved to
+func (org *organizer) chooseMoveDestination(s tcell.Screen) {
+	selected := org.entries[org.currentLine]
+	if selected.filename == ".." || selected.filename == recentFilename {
+		return
+	}
+	source := filepath.Join(org.currentDirectory, selected.filename)
+	destinations := []*entry{}
+	filepath.Walk(org.directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if path != org.directory && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if selected.isDir && path == source {
+			return filepath.SkipDir // a Folder can't go inside itself
+		}
+		if filepath.Clean(path) != filepath.Clean(org.currentDirectory) {
+			destinations = append(destinations, newEntry(org.folderPath(path), path, true))
+		}
+		return nil
+	})
+	if len(destinations) == 0 {
+		prompt(s, "There are no other Folders to move to")
+		return
+	}
+	sort.Slice(destinations, func(i, j int) bool { return destinations[i].name < destinations[j].name })
+	org.moving = source
+	org.enterMode(moveMode, destinations)
+}
+
+// The names of the Folders leading down to dir
+func (org *organizer) folderPath(dir string) string {
+	var names []string
+	for dir = filepath.Clean(dir); ; dir = filepath.Dir(dir) {
+		names = append([]string{org.folderFor(dir).Name}, names...)
+		if dir == filepath.Clean(org.directory) || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	return strings.Join(names, " / ")
+}
+
+// Move the Folder or outline we chose to move into the directory dest
+func (org *organizer) moveTo(s tcell.Screen, dest string) {
+	source := org.moving
+	org.moving = ""
+	target := filepath.Join(dest, filepath.Base(source))
+	if err := org.moveFile(source, target); err != nil {
+		prompt(s, fmt.Sprintf("Error moving %s; %v", source, err))
+		return
+	}
+	org.folderIndex.move(org.folderKey(source), org.folderKey(target))
+	org.saveFolderIndex()
+}
+
+// Something has moved from source to target.  If it was the outline we are editing (or the Folder holding it),
+//  keep saving to the right place.
+func (e *editor) fileMoved(source string, target string) {
+	path := e.filePath()
+	if currentFilename == "" || (path != source && !strings.HasPrefix(path, source+string(filepath.Separator))) {
+		return
+	}
+	path = target + strings.TrimPrefix(path, source)
+	currentFilename = filepath.Base(path)
+	currentFileDirectory = filepath.Dir(path)
+	e.rememberOutline(path)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFolders(t *testing.T) {
+
+	fmt.Println("Folders missing from the index are added")
+	base := t.TempDir()
+	storage := filepath.Join(base, "outlines")
+	for _, dir := range []string{"work", "work/projects", "home"} {
+		if err := os.MkdirAll(filepath.Join(storage, dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	org, err := newOrganizer(base, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(*org.folderIndex, "/outlines/home")
+	if f := org.folderFor(filepath.Join(storage, "home")); f.Name != "home" || (*org.folderIndex)["/outlines/home"] != f {
+		t.Errorf("Fail: wanted home to be added to the index got %v\n", *org.folderIndex)
+	}
+	(*org.folderIndex)["/outlines/work"].Name = "Work"
+	if path := org.folderPath(filepath.Join(storage, "work", "projects")); path != "outlines / Work / projects" {
+		t.Errorf("Fail: wanted path outlines / Work / projects got %s\n", path)
+	}
+
+	fmt.Println("Moving a Folder rewrites the keys beneath it")
+	cfg = make(config)
+	currentFileDirectory = filepath.Join(storage, "work", "projects")
+	currentFilename = "plan.gv"
+	org.moving = filepath.Join(storage, "work")
+	org.moveTo(nil, filepath.Join(storage, "home"))
+	if _, err := os.Stat(filepath.Join(storage, "home", "work", "projects")); err != nil {
+		t.Errorf("Fail: work was not moved; %v\n", err)
+	}
+	fi := *org.folderIndex
+	if fi["/outlines/work"] != nil || fi["/outlines/home/work"].Name != "Work" || fi["/outlines/home/work/projects"] == nil {
+		t.Errorf("Fail: index keys not rewritten; %v\n", fi)
+	}
+	if currentFileDirectory != filepath.Join(storage, "home", "work", "projects") || cfg[lastOpenedOutlineCfgKey] != filepath.Join(currentFileDirectory, "plan.gv") {
+		t.Errorf("Fail: the open outline should have moved with its Folder, got %s\n", currentFileDirectory)
+	}
+
+	fmt.Println("Removing a Folder forgets the keys beneath it")
+	org.folderIndex.remove("/outlines/home")
+	if len(fi) != 1 || fi["/outlines"] == nil {
+		t.Errorf("Fail: wanted only /outlines left got %v\n", fi)
+	}
+	currentFileDirectory = ""
+	currentFilename = ""
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+Inline formatting within Headline (and Note) text.  Formatting is written with Markdown style markers
+
+	**bold**    *italic*    `code`    ~~strike~~
+
+The markers are part of the text itself, so they survive copy/paste and come out as Markdown wherever the text
+goes.  When rendering, the text between markers gets the matching tcell attributes and the markers themselves are
+hidden- except in the Headline (or Note) under the cursor, so they can still be seen and edited.  Hidden markers
+take up no room when the text is word-wrapped or when moving up and down through it either.
+
+*/
+
+type textFormat int
+
+const (
+	formatBold textFormat = 1 << iota
+	formatItalic
+	formatCode
+	formatStrike
+)
+
+// Markers in the order we look for them ("**" has to be tried before "*")
+var formatMarkers = []struct {
+	marker string
+	format textFormat
+}{
+	{"`", formatCode},
+	{"**", formatBold},
+	{"~~", formatStrike},
+	{"*", formatItalic},
+}
+
+// ALT-key that toggles each marker on the selection
+var formatKeys = map[rune]string{'b': "**", 'i': "*", 'c': "`", 's': "~~"}
+
+// a formatted span found within some text
+type span struct {
+	start  int // position of the opening marker
+	end    int // position just after the closing marker
+	marker int // length of the opening (and closing) marker
+	format textFormat
+}
+
+// Find all of the formatted spans within the text of buf.  Like links, spans never cross lines.
+func findFormatting(buf *PieceTable) []span {
+	var spans []span
+	var line []rune
+	lineStart := 0
+	it := buf.Iterator(0)
+	for r, ok := it.Next(); ok; r, ok = it.Next() {
+		if r == '\n' {
+			spans = append(spans, formattingIn(line, lineStart)...)
+			line = line[:0]
+			lineStart = it.Position()
+		} else {
+			line = append(line, r)
+		}
+	}
+	return append(spans, formattingIn(line, lineStart)...)
+}
+
+// Find the formatted spans within a single line of text which starts at position offset.  An opening marker
+//  must be followed by a non-space and a closing marker preceded by one (so "2 * 3 * 4" isn't italic).  Nothing
+//  is formatted within code.
+func formattingIn(line []rune, offset int) []span {
+	var spans []span
+	open := make(map[textFormat]int) // where each format's (unmatched) opening marker is
+	for i := 0; i < len(line); {
+		marker, format := markerAt(line, i)
+		if _, inCode := open[formatCode]; marker == "" || (inCode && format != formatCode) {
+			i++
+			continue
+		}
+		length := len(marker)
+		if start, found := open[format]; found && i > start+length && !unicode.IsSpace(line[i-1]) {
+			spans = append(spans, span{offset + start, offset + i + length, length, format})
+			delete(open, format)
+		} else if i+length < len(line) && !unicode.IsSpace(line[i+length]) {
+			open[format] = i
+		}
+		i += length
+	}
+	return spans
+}
+
+// the marker (and its format) starting at line[i], if there is one
+func markerAt(line []rune, i int) (string, textFormat) {
+	for _, m := range formatMarkers {
+		if hasPrefix(line[i:], m.marker) {
+			return m.marker, m.format
+		}
+	}
+	return "", 0
+}
+
+func hasPrefix(runes []rune, prefix string) bool {
+	p := []rune(prefix)
+	if len(runes) < len(p) {
+		return false
+	}
+	for i := range p {
+		if runes[i] != p[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// The formatting that applies at position, and whether position is part of a marker
+func formatAt(spans []span, position int) (textFormat, bool) {
+	var format textFormat
+	isMarker := false
+	for _, s := range spans {
+		if position >= s.start && position < s.end {
+			format |= s.format
+			if position < s.start+s.marker || position >= s.end-s.marker {
+				isMarker = true
+			}
+		}
+	}
+	return format, isMarker
+}
+
+// Add the attributes for a format to style
+func (f textFormat) apply(style tcell.Style) tcell.Style {
+	if f&formatBold != 0 {
+		style = style.Bold(true)
+	}
+	if f&formatItalic != 0 {
+		style = style.Italic(true)
+	}
+	if f&formatCode != 0 {
+		style = style.Foreground(codeColor)
+	}
+	if f&formatStrike != 0 {
+		style = style.StrikeThrough(true)
+	}
+	return style
+}
+
+// Wrap the selection in marker, or unwrap it if it is already wrapped in marker.  This is a single edit as far as
+//  undo is concerned.
+func (e *editor) toggleFormat(marker string) {
+	if !e.isSelecting() {
+		return
+	}
+	buf := e.currentBuf()
+	m := []rune(marker)
+	start := e.sel.startPosition
+	end := e.selectionEnd()
+	if end > buf.Len()-1 {
+		end = buf.Len() - 1 // never wrap the trailing nodeDelim
+	}
+	if start >= end {
+		return
+	}
+	shift := len(m)
+	buf.BeginGroup()
+	if start >= len(m) && end+len(m) <= buf.Len() &&
+		string(buf.Slice(start-len(m), start)) == marker && string(buf.Slice(end, end+len(m))) == marker {
+		buf.Delete(end, len(m))
+		buf.Delete(start-len(m), len(m))
+		shift = -shift
+	} else {
+		buf.InsertRunes(end, m)
+		buf.InsertRunes(start, m)
+	}
+	buf.EndGroup()
+	// Keep the selection (and cursor) on the same text
+	moved := func(p int) int {
+		if p >= end {
+			return p + 2*shift
+		} else if p >= start {
+			return p + shift
+		}
+		return p
+	}
+	e.currentPosition = moved(e.currentPosition)
+	e.sel.startPosition = start + shift
+	e.sel.endPosition = prevClusterStart(buf, end+shift)
+}
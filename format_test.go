@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFormatting(t *testing.T) {
+
+	fmt.Println("Find formatted spans")
+	spans := findFormatting(NewPieceTable("**bold** *it* `co*de*` ~~gone~~ 2 * 3 * 4 **open\n*next* line"))
+	wanted := []span{{0, 8, 2, formatBold}, {9, 13, 1, formatItalic}, {14, 22, 1, formatCode}, {23, 31, 2, formatStrike}, {49, 55, 1, formatItalic}}
+	if len(spans) != len(wanted) {
+		t.Fatalf("Fail: wanted %v got %v\n", wanted, spans)
+	}
+	for i := range wanted {
+		if spans[i] != wanted[i] {
+			t.Errorf("Fail: span %d wanted %+v got %+v\n", i, wanted[i], spans[i])
+		}
+	}
+
+	fmt.Println("Nested formats and markers")
+	spans = findFormatting(NewPieceTable("***both***"))
+	if format, isMarker := formatAt(spans, 4); format != formatBold|formatItalic || isMarker {
+		t.Errorf("Fail: inside ***both*** got format %d marker %v (%v)\n", format, isMarker, spans)
+	}
+	if _, isMarker := formatAt(spans, 1); !isMarker {
+		t.Errorf("Fail: position 1 of ***both*** should be a marker (%v)\n", spans)
+	}
+
+	fmt.Println("Toggle formatting on a selection")
+	o := testOutline()
+	e := &editor{out: o, currentHeadlineID: 1}
+	h := o.headlineIndex[1]
+	h.Buf = *NewPieceTable("make this bold" + emptyHeadlineText)
+	e.sel = &selection{1, 5, 8}
+	e.currentPosition = 8
+	e.toggleFormat("**")
+	if h.plainText() != "make **this** bold" || e.sel.startPosition != 7 || e.sel.endPosition != 10 || e.currentPosition != 10 {
+		t.Errorf("Fail: toggling bold on got >%s< selection %+v cursor %d\n", h.plainText(), *e.sel, e.currentPosition)
+	}
+	e.toggleFormat("**")
+	if h.plainText() != "make this bold" || e.sel.startPosition != 5 || e.sel.endPosition != 8 {
+		t.Errorf("Fail: toggling bold off got >%s< selection %+v\n", h.plainText(), *e.sel)
+	}
+	h.Buf.Undo()
+	if h.plainText() != "make **this** bold" {
+		t.Errorf("Fail: undoing toggle got >%s<\n", h.plainText())
+	}
+
+	fmt.Println("Redo reports whether there was anything to redo")
+	if !e.redo() || h.plainText() != "make this bold" {
+		t.Errorf("Fail: redoing toggle got >%s<\n", h.plainText())
+	}
+	if e.redo() {
+		t.Errorf("Fail: there should be nothing left to redo\n")
+	}
+}
@@ -4,5 +4,5 @@ go 1.16
 
 require (
 	github.com/gdamore/tcell/v2 v2.1.0
-	github.com/mattn/go-runewidth v0.0.9 // indirect
+	github.com/mattn/go-runewidth v0.0.9
 )
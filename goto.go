@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+Go to Headline (CTRL-G) picks any Headline in the outline by typing a few characters of it, or of the Headlines
+above it- each Headline is listed as the path down to it ("Project › Q3 › Risks").  The Headline picked is
+revealed (its ancestors are expanded) and scrolled to the middle of the window.
+
+Typing # and a Headline's ID (as in a [[#42]] link) goes straight to that Headline, which is handy for debugging.
+So does just the ID, when it matches nothing else.
+
+*/
+
+const headlinePathSeparator = " › "
+
+// Every Headline in the outline (in order) with items to pick them by
+func (o *Outline) headlinePaths() ([]*Headline, []pickerItem) {
+	var headlines []*Headline
+	var items []pickerItem
+	var path []string // text of the Headlines leading down to the current one
+	o.walk(func(h *Headline, level int) {
+		text := strings.Join(strings.Fields(h.plainText()), " ") // Headlines can have more than one line
+		if text == "" {
+			text = "(blank)"
+		}
+		path = append(path[:level-1], text)
+		headlines = append(headlines, h)
+		items = append(items, pickerItem{strings.Join(path, headlinePathSeparator), ""})
+	})
+	return headlines, items
+}
+
+// Pick a Headline and put the cursor on it
+func (e *editor) goToHeadline(s tcell.Screen) {
+	headlines, items := e.out.headlinePaths()
+	i, query, ok := pick(s, "Go to Headline", items)
+	if !ok {
+		return
+	}
+	var h *Headline
+	query = strings.TrimSpace(query)
+	if id, err := strconv.Atoi(strings.TrimPrefix(query, "#")); err == nil && (i == -1 || strings.HasPrefix(query, "#")) {
+		h = e.out.findHeadline(id) // an ID (or nothing matched, but it may be an ID)
+	}
+	if h == nil && i != -1 {
+		h = headlines[i]
+	}
+	if h != nil {
+		e.moveToHeadline(h, 0)
+		e.centerCursor(s)
+	}
+}
+
+// Scroll so the line beneath the cursor is in the middle of the window (or as near as we can get)
+func (e *editor) centerCursor(s tcell.Screen) {
+	e.layoutOutline(s)
+	e.scrollToCursor()
+	e.topLine = e.linePtr - e.editorHeight/2
+	if last := len(e.lineIndex) - e.editorHeight; e.topLine > last {
+		e.topLine = last
+	}
+	if e.topLine < 0 {
+		e.topLine = 0
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestGoToHeadline(t *testing.T) {
+
+	fmt.Println("List Headlines by their paths")
+	o := testOutline()
+	o.headlineIndex[5].Buf = *NewPieceTable("" + emptyHeadlineText)
+	headlines, items := o.headlinePaths()
+	var paths []string
+	for _, item := range items {
+		paths = append(paths, item.label)
+	}
+	if fmt.Sprint(paths) != "[One One › A One › A › i One › B (blank)]" || headlines[2].plainText() != "i" {
+		t.Errorf("Fail: wanted paths [One One › A One › A › i One › B (blank)] got %v\n", paths)
+	}
+	if matches := rankItems(items, "o a i"); len(matches) == 0 || matches[0].index != 2 {
+		t.Errorf("Fail: wanted One › A › i to match best got %v\n", matches)
+	}
+
+	fmt.Println("Center the Headline we go to")
+	o = bigOutline(100)
+	o.showToLevel(1)
+	e := layoutEditor(o)
+	target := o.headlineIndex[o.Headlines[50].ID].Children[1]
+	e.moveToHeadline(target, 0)
+	e.centerCursor(nil)
+	if !o.Headlines[50].Expanded || e.lineIndex[e.linePtr].headlineID != target.ID || e.linePtr-e.topLine != e.editorHeight/2 {
+		t.Errorf("Fail: wanted line %d at the middle of the window got top line %d\n", e.linePtr, e.topLine)
+	}
+	e.moveToHeadline(o.Headlines[0], 0)
+	e.centerCursor(nil)
+	if e.topLine != 0 {
+		t.Errorf("Fail: can't scroll above the first line, got top line %d\n", e.topLine)
+	}
+
+	fmt.Println("Go to a Headline by its ID only when nothing matches")
+	s := tcell.NewSimulationScreen("")
+	s.Init()
+	s.SetSize(80, 24)
+	screenWidth, screenHeight = s.Size()
+	defer s.Fini()
+	o = testOutline()
+	e = layoutEditor(o)
+	e.currentHeadlineID = 1
+	goTo := func(keys string, key tcell.Key) int {
+		for _, r := range keys {
+			s.InjectKey(tcell.KeyRune, r, tcell.ModNone)
+		}
+		s.InjectKey(key, 0, tcell.ModNone)
+		e.goToHeadline(s)
+		return e.currentHeadlineID
+	}
+	if id := goTo("3", tcell.KeyEscape); id != 1 {
+		t.Errorf("Fail: ESC should stay put, but went to %d\n", id)
+	}
+	if id := goTo("3", tcell.KeyEnter); id != 3 {
+		t.Errorf("Fail: wanted Headline 3 (nothing matches 3) got %d\n", id)
+	}
+	if id := goTo("oa", tcell.KeyEnter); id != 2 {
+		t.Errorf("Fail: wanted One › A (2) picked got %d\n", id)
+	}
+
+	fmt.Println("Go to a Headline by # and its ID, even when Headlines have digits in them")
+	o = bigOutline(20)
+	e = layoutEditor(o)
+	e.currentHeadlineID = 1
+	if id := goTo("#12", tcell.KeyEnter); id != 12 {
+		t.Errorf("Fail: wanted Headline 12 got %d\n", id)
+	}
+	if id := goTo("#999", tcell.KeyEnter); id != 12 {
+		t.Errorf("Fail: there is no Headline 999 (and nothing matches), so should stay put, got %d\n", id)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+/*
+
+Grapheme clusters and display widths.
+
+What the user sees as a single character may be several runes (a letter followed by combining accents, an emoji
+with a skin tone or a family of emoji joined together), and may take up two cells on the screen (CJK text and most
+emoji).  The cursor moves a cluster at a time, and layout measures text by the cells its clusters occupy rather
+than by counting runes.
+
+This is a simplified version of the Unicode segmentation rules, but it handles the clusters people actually type.
+
+*/
+
+const zeroWidthJoiner = '\u200d'
+
+// Does r join onto the cluster so far rather than starting a new one?
+func joinsCluster(cluster []rune, r rune) bool {
+	last := cluster[len(cluster)-1]
+	switch {
+	case last == zeroWidthJoiner:
+		return true
+	case r == zeroWidthJoiner, isVariationSelector(r), isEmojiModifier(r):
+		return true
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		return true
+	case isRegionalIndicator(r): // flags are pairs of regional indicators
+		return len(cluster) == 1 && isRegionalIndicator(last)
+	}
+	return false
+}
+
+// Could r be part of the cluster before it?  (used to find a safe place to start looking for clusters)
+func mayContinueCluster(r rune) bool {
+	return r == zeroWidthJoiner || isVariationSelector(r) || isEmojiModifier(r) || isRegionalIndicator(r) ||
+		unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)
+}
+
+func isVariationSelector(r rune) bool {
+	return (r >= '\ufe00' && r <= '\ufe0f') || (r >= '\U000e0100' && r <= '\U000e01ef')
+}
+
+func isEmojiModifier(r rune) bool {
+	return r >= '\U0001f3fb' && r <= '\U0001f3ff'
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= '\U0001f1e6' && r <= '\U0001f1ff'
+}
+
+// The number of cells a cluster takes up on the screen.  Every cluster gets at least one cell (even
+//  non-printing runes like nodeDelim) so the cursor always has somewhere to be.
+func clusterWidth(cluster []rune) int {
+	w := runewidth.RuneWidth(cluster[0])
+	if len(cluster) > 1 && (w == 1 && (cluster[1] == '\ufe0f' || isRegionalIndicator(cluster[0]))) {
+		w = 2 // emoji presentation, or a flag
+	}
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// Read the cluster starting at the iterator's position, without going past limit
+func nextCluster(it *RuneIterator, limit int) []rune {
+	if it.Position() >= limit {
+		return nil
+	}
+	r, ok := it.Next()
+	if !ok {
+		return nil
+	}
+	cluster := []rune{r}
+	for it.Position() < limit {
+		r, ok = it.Next()
+		if !ok {
+			break
+		}
+		if !joinsCluster(cluster, r) {
+			it.Prev()
+			break
+		}
+		cluster = append(cluster, r)
+	}
+	return cluster
+}
+
+// Split runes into clusters
+func clustersOf(runes []rune) [][]rune {
+	var clusters [][]rune
+	for i, r := range runes {
+		if len(clusters) > 0 && joinsCluster(clusters[len(clusters)-1], r) {
+			clusters[len(clusters)-1] = append(clusters[len(clusters)-1], r)
+		} else {
+			clusters = append(clusters, runes[i:i+1:i+1])
+		}
+	}
+	return clusters
+}
+
+// The position of the cluster following the one at position
+func nextClusterStart(buf *PieceTable, position int) int {
+	it := buf.Iterator(position)
+	nextCluster(it, buf.Len())
+	return it.Position()
+}
+
+// The position of the cluster before position
+func prevClusterStart(buf *PieceTable, position int) int {
+	if position <= 0 {
+		return 0
+	}
+	// Back up to a rune that must start a cluster, then find clusters going forward from there
+	start := position - 1
+	for start > 0 && (mayContinueCluster(buf.RuneAt(start)) || buf.RuneAt(start-1) == zeroWidthJoiner) {
+		start--
+	}
+	it := buf.Iterator(start)
+	for {
+		cluster := nextCluster(it, position)
+		if cluster == nil || it.Position() >= position {
+			return it.Position() - len(cluster)
+		}
+	}
+}
+
+// How many cells the cluster at position p is drawn in.  Formatting markers in hidden (the spans whose markers
+//  aren't being shown, see format.go) aren't drawn at all.
+func displayWidth(cluster []rune, p int, hidden []span) int {
+	if _, isMarker := formatAt(hidden, p); isMarker {
+		return 0
+	}
+	return clusterWidth(cluster)
+}
+
+// How far (from pos, and not past end) the text of buf can go while taking up no more than width cells.
+//  Always includes at least one cluster so that layout makes progress.
+func fitWidth(buf *PieceTable, pos int, end int, width int, hidden []span) int {
+	it := buf.Iterator(pos)
+	used := 0
+	for it.Position() < end {
+		p := it.Position()
+		used += displayWidth(nextCluster(it, end), p, hidden)
+		if used > width && p > pos {
+			return p
+		}
+	}
+	return end
+}
+
+// The screen column (relative to start) where the cluster at position is drawn
+func columnOf(buf *PieceTable, start int, position int, hidden []span) int {
+	it := buf.Iterator(start)
+	col := 0
+	for it.Position() < position {
+		p := it.Position()
+		cluster := nextCluster(it, position)
+		if cluster == nil {
+			break
+		}
+		col += displayWidth(cluster, p, hidden)
+	}
+	return col
+}
+
+// The position of the cluster drawn at column col of the text running from start to end.  If the text
+//  doesn't reach that far, we get the last cluster.
+func positionAtColumn(buf *PieceTable, start int, end int, col int, hidden []span) int {
+	it := buf.Iterator(start)
+	x := 0
+	p := start
+	for it.Position() < end {
+		p = it.Position()
+		x += displayWidth(nextCluster(it, end), p, hidden)
+		if x > col {
+			break
+		}
+	}
+	return p
+}
+
+// Draw text at (x, y) in no more than width cells.  Text that doesn't fit is cut short with an ellipsis.
+//  Returns how many cells were used.
+func drawText(s tcell.Screen, x int, y int, text string, width int, style tcell.Style) int {
+	clusters := clustersOf([]rune(text))
+	total := 0
+	for _, c := range clusters {
+		total += clusterWidth(c)
+	}
+	used := 0
+	for _, c := range clusters {
+		w := clusterWidth(c)
+		if total > width && used+w > width-1 { // leave room for the ellipsis
+			s.SetContent(x+used, y, ellipsis, nil, style)
+			return used + 1
+		}
+		s.SetContent(x+used, y, c[0], c[1:], style)
+		used += w
+	}
+	return used
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGraphemes(t *testing.T) {
+
+	// e + combining acute, a CJK character, a thumbs up with a skin tone, a flag and a family joined with ZWJs
+	text := "é漢👍🏽🇨🇦👩‍👩‍👧x" + emptyHeadlineText
+	buf := NewPieceTable(text)
+	starts := []int{0, 2, 3, 5, 7, 12, 13}
+	widths := []int{1, 2, 2, 2, 2, 1, 1}
+
+	fmt.Println("Step through clusters")
+	p := 0
+	for i, start := range starts {
+		if p != start {
+			t.Errorf("Fail: cluster %d wanted to start at %d got %d\n", i, start, p)
+		}
+		if i < len(starts)-1 {
+			p = nextClusterStart(buf, p)
+		}
+	}
+	for i := len(starts) - 1; i > 0; i-- {
+		if back := prevClusterStart(buf, starts[i]); back != starts[i-1] {
+			t.Errorf("Fail: cluster before %d wanted %d got %d\n", starts[i], starts[i-1], back)
+		}
+	}
+
+	fmt.Println("Cluster widths")
+	for i, c := range clustersOf([]rune(text)) {
+		if clusterWidth(c) != widths[i] {
+			t.Errorf("Fail: cluster %d (%q) wanted width %d got %d\n", i, string(c), widths[i], clusterWidth(c))
+		}
+	}
+
+	fmt.Println("Columns and fitting")
+	if col := columnOf(buf, 0, 7, nil); col != 7 {
+		t.Errorf("Fail: column of the flag wanted 7 got %d\n", col)
+	}
+	if p := positionAtColumn(buf, 0, buf.Len(), 4, nil); p != 3 {
+		t.Errorf("Fail: position at column 4 wanted 3 got %d\n", p)
+	}
+	if p := positionAtColumn(buf, 0, buf.Len(), 100, nil); p != 13 {
+		t.Errorf("Fail: position past the end wanted 13 got %d\n", p)
+	}
+	if end := fitWidth(buf, 0, buf.Len(), 4, nil); end != 3 { // the emoji would need columns 3 and 4
+		t.Errorf("Fail: fitting 4 columns wanted 3 got %d\n", end)
+	}
+	if end := fitWidth(buf, 2, buf.Len(), 1, nil); end != 3 { // a too wide cluster still makes progress
+		t.Errorf("Fail: fitting 1 column wanted 3 got %d\n", end)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+The journal is an outline for each day, kept in a "Journal" Folder beneath the outlines Folder and filed by year
+and month (journal/2021/03/2021-03-14.gv).  F2 opens today's entry, creating it (and any Folders it needs) if it
+isn't there yet.  While editing an entry ALT-LEFT and ALT-RIGHT step back to the previous entry or on to the next
+one (or to today's, after the last).
+
+A new entry starts as a copy of the journal template ($GVHOME/templates/journal.gv, or the template named by
+journalTemplate in gv.conf) if there is one.  When journalCarryForward is "true" in gv.conf, any unfinished
+checkbox Headlines ("[ ] ...") in the previous entry are copied into the new one.
+
+*/
+
+const journalDirectory = "journal"
+const journalFolderName = "Journal"
+
+const journalTemplateCfgKey = "journalTemplate"
+const journalCarryForwardCfgKey = "journalCarryForward"
+
+const defaultJournalTemplate = "journal.gv"
+
+const journalDateFormat = "2006-01-02"
+
+const uncheckedBox = "[ ]"
+
+// Where the journal entry for day is kept
+func (org *organizer) journalPath(day time.Time) string {
+	return filepath.Join(org.directory, journalDirectory, day.Format("2006"), day.Format("01"), day.Format(journalDateFormat)+".gv")
+}
+
+// The day of the journal entry at path, or false if it isn't a journal entry
+func (org *organizer) journalDay(path string) (time.Time, bool) {
+	if filepath.Dir(filepath.Dir(filepath.Dir(path))) != filepath.Join(org.directory, journalDirectory) {
+		return time.Time{}, false
+	}
+	day, err := time.ParseInLocation(journalDateFormat, strings.TrimSuffix(filepath.Base(path), ".gv"), time.Local)
+	if err != nil || org.journalPath(day) != path {
+		return time.Time{}, false
+	}
+	return day, true
+}
+
+// The days with journal entries, oldest first
+func (org *organizer) journalDays() []time.Time {
+	var days []time.Time
+	filepath.Walk(filepath.Join(org.directory, journalDirectory),
+		func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return nil // skip anything we can't read
+			}
+			if day, ok := org.journalDay(path); ok && fi.Mode().IsRegular() {
+				days = append(days, day)
+			}
+			return nil
+		})
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// Make sure the Journal, year and month Folders for day are there.  Returns the path to the month's Folder.
+func (org *organizer) makeJournalFolders(day time.Time) (string, error) {
+	dir := org.directory
+	folders := []struct{ fileName, name string }{
+		{journalDirectory, journalFolderName},
+		{day.Format("2006"), day.Format("2006")},
+		{day.Format("01"), day.Format("01 January")},
+	}
+	for _, f := range folders {
+		path := filepath.Join(dir, f.fileName)
+		if _, err := os.Stat(path); err != nil {
+			if path, err = org.makeFolder(dir, f.fileName, f.name); err != nil {
+				return "", err
+			}
+		}
+		dir = path
+	}
+	return dir, nil
+}
+
+// Open the journal entry for day, creating it if it isn't there yet.  Returns false if it couldn't be opened
+//  (or the user chose not to leave the outline they were editing).
+func (e *editor) openJournal(s tcell.Screen, day time.Time) bool {
+	path := e.org.journalPath(day)
+	if path == e.filePath() {
+		return true
+	}
+	if _, err := os.Stat(path); err == nil {
+		e.open(s, path)
+		return e.filePath() == path
+	}
+	if e.dirty && !e.saveFirst(s) {
+		return false
+	}
+	dir, err := e.org.makeJournalFolders(day)
+	if err != nil {
+		prompt(s, "Unable to create the journal Folders; "+err.Error())
+		return false
+	}
+	out := e.org.newJournalEntry(day)
+	if cfg[journalCarryForwardCfgKey] == "true" {
+		days := e.org.journalDays()
+		if i := sort.Search(len(days), func(i int) bool { return !days[i].Before(day) }); i > 0 {
+			if previous, err := loadOutline(e.org.journalPath(days[i-1])); err == nil {
+				carryForward(previous, out)
+			}
+		}
+	}
+	e.startOutline(out, dir, filepath.Base(path))
+	e.org.refresh(s)
+	return true
+}
+
+// Open (or start) today's journal entry.  Returns false if it wasn't opened.
+func (e *editor) openTodaysJournal(s tcell.Screen) bool {
+	return e.openJournal(s, startOfDay(time.Now()))
+}
+
+// A new journal entry for day (from the journal template if there is one)
+func (org *organizer) newJournalEntry(day time.Time) *Outline {
+	title := day.Format(journalDateFormat + " Monday")
+	template := cfg[journalTemplateCfgKey]
+	if template == "" {
+		template = defaultJournalTemplate
+	}
+	values := templateValues(title)
+	values["date"] = day.Format(journalDateFormat)
+	if out, err := outlineFromTemplate(filepath.Join(org.baseDir, templatesDirectory, template), values); err == nil {
+		return out
+	}
+	out := newOutline(title)
+	out.addHeadline("", -1) // somewhere to start writing (ahead of anything carried forward)
+	return out
+}
+
+// Step from the journal entry being edited to the previous (direction -1) or next (1) entry.  After the last
+//  entry comes today's.  Returns false if the outline being edited isn't a journal entry.
+func (e *editor) stepJournal(s tcell.Screen, direction int) bool {
+	current, ok := e.org.journalDay(e.filePath())
+	if !ok {
+		return false
+	}
+	days := e.org.journalDays()
+	i := sort.Search(len(days), func(i int) bool { return !days[i].Before(current) })
+	if direction < 0 && i > 0 {
+		e.openJournal(s, days[i-1])
+	} else if direction > 0 {
+		if i < len(days) && days[i].Equal(current) {
+			i++
+		}
+		if i < len(days) {
+			e.openJournal(s, days[i])
+		} else if today := startOfDay(time.Now()); current.Before(today) {
+			e.openJournal(s, today)
+		}
+	}
+	return true
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// Is h an unfinished checkbox Headline?
+func (h *Headline) isUnchecked() bool {
+	return strings.HasPrefix(strings.TrimSpace(h.plainText()), uncheckedBox)
+}
+
+// Copy the unfinished checkbox Headlines (and their children) in from onto the end of to
+func carryForward(from *Outline, to *Outline) {
+	var carry func(headlines []*Headline)
+	carry = func(headlines []*Headline) {
+		for _, h := range headlines {
+			if !h.isUnchecked() {
+				carry(h.Children)
+				continue
+			}
+			c := to.cloneHeadline(h, -1, false)
+			to.Headlines = append(to.Headlines, c)
+			to.addHeadlineToIndex(c)
+		}
+	}
+	carry(from.Headlines)
+}
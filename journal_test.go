@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestJournal(t *testing.T) {
+
+	fmt.Println("Journal entries are filed by year and month")
+	base := t.TempDir()
+	storage := filepath.Join(base, "outlines")
+	os.Mkdir(storage, 0700)
+	org, err := newOrganizer(base, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2021, time.March, 14, 0, 0, 0, 0, time.Local)
+	path := org.journalPath(day)
+	if path != filepath.Join(storage, "journal", "2021", "03", "2021-03-14.gv") {
+		t.Errorf("Fail: wrong journal path %s\n", path)
+	}
+	if d, ok := org.journalDay(path); !ok || !d.Equal(day) {
+		t.Errorf("Fail: wanted %v from %s got %v\n", day, path, d)
+	}
+	if _, ok := org.journalDay(filepath.Join(storage, "journal", "2021", "04", "2021-03-14.gv")); ok {
+		t.Errorf("Fail: an entry filed in the wrong month isn't a journal entry\n")
+	}
+
+	fmt.Println("Journal Folders are created and indexed")
+	dir, err := org.makeJournalFolders(day)
+	if err != nil || dir != filepath.Dir(path) {
+		t.Fatalf("Fail: wanted %s got %s; %v\n", filepath.Dir(path), dir, err)
+	}
+	fi := *org.folderIndex
+	if fi["/outlines/journal"].Name != "Journal" || fi["/outlines/journal/2021/03"].Name != "03 March" {
+		t.Errorf("Fail: journal Folders not indexed; %v\n", fi)
+	}
+	if _, err := org.makeJournalFolders(day.AddDate(0, 0, 1)); err != nil {
+		t.Errorf("Fail: existing journal Folders should be reused; %v\n", err)
+	}
+
+	fmt.Println("Journal days are found oldest first")
+	for _, d := range []time.Time{day, day.AddDate(0, -1, 3)} {
+		org.makeJournalFolders(d)
+		ioutil.WriteFile(org.journalPath(d), []byte("{}"), 0644)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "notes.gv"), []byte("{}"), 0644)
+	if days := org.journalDays(); len(days) != 2 || !days[0].Equal(day.AddDate(0, -1, 3)) || !days[1].Equal(day) {
+		t.Errorf("Fail: wrong journal days %v\n", days)
+	}
+
+	fmt.Println("Unfinished checkboxes are carried forward")
+	cfg = make(config)
+	previous := newOutline("2021-03-13 Saturday")
+	previous.addHeadline("[x] Done", -1)
+	open, _ := previous.addHeadline("[ ] Not done", -1)
+	previous.addHeadline("Step one", open)
+	parent, _ := previous.addHeadline("Errands", -1)
+	previous.addHeadline("[ ] Post office", parent)
+	entry := org.newJournalEntry(day)
+	carryForward(previous, entry)
+	if entry.Title != "2021-03-14 Sunday" || len(entry.Headlines) != 3 {
+		t.Fatalf("Fail: wanted a blank Headline and two carried forward got %d in %s\n", len(entry.Headlines), entry.Title)
+	}
+	carried := entry.Headlines[1]
+	if carried.plainText() != "[ ] Not done" || len(carried.Children) != 1 || entry.Headlines[2].plainText() != "[ ] Post office" {
+		t.Errorf("Fail: wrong Headlines carried forward %s\n", carried.plainText())
+	}
+	if carried.UID == previous.headlineIndex[open].UID || entry.headlineIndex[carried.Children[0].ID] == nil {
+		t.Errorf("Fail: carried Headlines should be new Headlines in the new entry\n")
+	}
+
+	fmt.Println("An entry whose Folders can't be created isn't opened")
+	s := tcell.NewSimulationScreen("")
+	s.Init()
+	s.SetSize(80, 24)
+	screenWidth, screenHeight = s.Size()
+	defer s.Fini()
+	ioutil.WriteFile(filepath.Join(storage, "journal", "2022"), []byte("not a Folder"), 0644)
+	s.InjectKey(tcell.KeyEnter, 0, tcell.ModNone) // (dismiss the error)
+	e := &editor{org: org}
+	if e.openJournal(s, time.Date(2022, time.January, 5, 0, 0, 0, 0, time.Local)) || e.out != nil {
+		t.Errorf("Fail: wanted no journal entry opened got %s\n", e.filePath())
+	}
+}
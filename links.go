@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+Links between Headlines.  A link is written inside Headline (or Note) text as
+
+	[[Outline Title#headline text]]   - a Headline in another outline, found by its text
+	[[Outline Title#<uid>]]           - a Headline in another outline, found by its UID
+	[[Outline Title#42]]              - a Headline in another outline, found by its (legacy) ID
+	[[Outline Title]]                 - the first Headline of another outline
+	[[#headline text]]                - a Headline in this outline
+
+Following a link opens the target outline (if necessary) and puts the cursor on the target Headline.  Every
+link we follow is remembered so we can go back to where we came from.
+
+*/
+
+const linkSeparator = '#'
+
+// a link found within some text
+type link struct {
+	start   int    // position of the opening "[["
+	end     int    // position just after the closing "]]"
+	outline string // title of the target outline ("" means the current outline)
+	target  string // text or ID of the target Headline ("" means first Headline)
+}
+
+// where the cursor was before following a link
+type linkLocation struct {
+	filePath   string
+	headlineID int
+	position   int
+}
+
+// Find all of the links within the text of buf
+func findLinks(buf *PieceTable) []link {
+	var links []link
+	start := -1 // position of the most recent "[[" (-1 if we aren't inside one)
+	var previous rune
+	it := buf.Iterator(0)
+	for r, ok := it.Next(); ok; r, ok = it.Next() {
+		p := it.Position() - 1
+		switch {
+		case r == '\n': // links never span lines
+			start = -1
+		case r == '[' && previous == '[' && start == -1:
+			start = p - 1
+		case r == ']' && previous == ']' && start != -1:
+			if p-1 > start+2 {
+				links = append(links, newLink(start, p+1, string(buf.Slice(start+2, p-1))))
+			}
+			start = -1
+			r = 0 // don't let this bracket start another pair
+		}
+		previous = r
+	}
+	return links
+}
+
+func newLink(start int, end int, body string) link {
+	l := link{start: start, end: end, outline: body}
+	if i := strings.IndexRune(body, linkSeparator); i != -1 {
+		l.outline = body[:i]
+		l.target = body[i+1:]
+	}
+	l.outline = strings.TrimSpace(l.outline)
+	l.target = strings.TrimSpace(l.target)
+	return l
+}
+
+// Return the link that includes position within the text of buf (if any)
+func linkAt(buf *PieceTable, position int) (link, bool) {
+	for _, l := range findLinks(buf) {
+		if position >= l.start && position < l.end {
+			return l, true
+		}
+	}
+	return link{}, false
+}
+
+// Is position within any of the links?
+func inLink(links []link, position int) bool {
+	for _, l := range links {
+		if position >= l.start && position < l.end {
+			return true
+		}
+	}
+	return false
+}
+
+// the text of a Headline without its trailing nodeDelim
+func (h *Headline) plainText() string {
+	return strings.TrimSuffix(h.Buf.Text(), emptyHeadlineText)
+}
+
+// Find the Headline a link's target refers to- either by UID, ID or by (case insensitive) text
+func (o *Outline) findTarget(target string) *Headline {
+	if target == "" {
+		if len(o.Headlines) == 0 {
+			return nil
+		}
+		return o.Headlines[0]
+	}
+	if h := o.findHeadlineByUID(target); h != nil {
+		return h
+	}
+	if id, err := strconv.Atoi(target); err == nil {
+		if h := o.findHeadline(id); h != nil {
+			return h
+		}
+	}
+	var found *Headline
+	o.walk(func(h *Headline, level int) {
+		if found == nil && strings.EqualFold(strings.TrimSpace(h.plainText()), target) {
+			found = h
+		}
+	})
+	return found
+}
+
+// Find a Headline that is still part of the outline (the headlineIndex may hold deleted Headlines)
+func (o *Outline) findHeadline(ID int) *Headline {
+	var found *Headline
+	o.walk(func(h *Headline, level int) {
+		if h.ID == ID {
+			found = h
+		}
+	})
+	return found
+}
+
+// Make sure all of a Headline's ancestors are expanded so it is visible
+func (o *Outline) reveal(h *Headline) {
+	for p := h.ParentID; p != -1; p = o.headlineIndex[p].ParentID {
+		o.headlineIndex[p].Expanded = true
+	}
+}
+
+// Follow the link beneath the cursor
+func (e *editor) followLink(s tcell.Screen) {
+	l, found := linkAt(e.currentBuf(), e.currentPosition)
+	if !found {
+		return
+	}
+	from := linkLocation{e.filePath(), e.currentHeadlineID, e.currentPosition}
+	out := e.out
+	filePath := ""
+	if l.outline != "" && !strings.EqualFold(l.outline, e.out.Title) {
+		var err error
+		if filePath, err = e.org.findOutlineByTitle(l.outline); err == nil {
+			out, err = loadOutline(filePath)
+		}
+		if err != nil {
+			prompt(s, fmt.Sprintf("Unable to follow link: %v", err))
+			return
+		}
+	}
+	// Make sure the link leads somewhere before we leave this outline
+	h := out.findTarget(l.target)
+	if h == nil {
+		prompt(s, fmt.Sprintf("Unable to find Headline '%s' in %s", l.target, out.Title))
+		return
+	}
+	if filePath != "" {
+		if !e.openAt(s, filePath) {
+			return
+		}
+		if h = e.out.findHeadline(h.ID); h == nil {
+			return
+		}
+	}
+	e.linkHistory = append(e.linkHistory, from)
+	e.moveToHeadline(h, 0)
+}
+
+// Return to where we were before the last link was followed
+func (e *editor) followLinkBack(s tcell.Screen) {
+	if len(e.linkHistory) == 0 {
+		return
+	}
+	from := e.linkHistory[len(e.linkHistory)-1]
+	if from.filePath != e.filePath() && !e.openAt(s, from.filePath) {
+		return
+	}
+	e.linkHistory = e.linkHistory[:len(e.linkHistory)-1]
+	if h := e.out.findHeadline(from.headlineID); h != nil {
+		position := from.position
+		if position >= h.Buf.lastpos {
+			position = h.Buf.lastpos - 1
+		}
+		e.moveToHeadline(h, position)
+	}
+}
+
+// Open the outline at filePath, returning whether it is now the one being edited
+func (e *editor) openAt(s tcell.Screen, filePath string) bool {
+	e.open(s, filePath)
+	return e.filePath() == filePath
+}
+
+// Put the cursor on the given Headline, making sure it is visible
+func (e *editor) moveToHeadline(h *Headline, position int) {
+	e.out.reveal(h)
+	e.currentHeadlineID = h.ID
+	e.currentPosition = position
+	e.inNote = false
+	e.sel = nil
+}
+
+// Find the file holding the outline with this title somewhere beneath the storage directory
+func (org *organizer) findOutlineByTitle(title string) (string, error) {
+	var found string
+	err := filepath.Walk(org.directory,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if found != "" || info.IsDir() || !strings.HasSuffix(info.Name(), ".gv") {
+				return nil
+			}
+			cached, err := org.cache.infoFor(path, info)
+			if err == nil && strings.EqualFold(cached.title(), title) {
+				found = path
+			}
+			return nil
+		})
+	if err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", fmt.Errorf("no outline titled '%s'", title)
+	}
+	return found, nil
+}
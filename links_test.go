@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestLinks(t *testing.T) {
+
+	fmt.Println("Find links in text")
+	links := findLinks(NewPieceTable("see [[Other Outline#Some Headline]] and [[#42]] but not [[]] or [[broken"))
+	if len(links) != 2 {
+		t.Fatalf("Fail: wanted 2 links got %d (%v)\n", len(links), links)
+	}
+	if links[0].outline != "Other Outline" || links[0].target != "Some Headline" || links[0].start != 4 || links[0].end != 35 {
+		t.Errorf("Fail: first link parsed as %+v\n", links[0])
+	}
+	if links[1].outline != "" || links[1].target != "42" {
+		t.Errorf("Fail: second link parsed as %+v\n", links[1])
+	}
+
+	fmt.Println("Link without a Headline target")
+	links = findLinks(NewPieceTable("[[Just A Title]]"))
+	if len(links) != 1 || links[0].outline != "Just A Title" || links[0].target != "" {
+		t.Errorf("Fail: title only link parsed as %v\n", links)
+	}
+
+	fmt.Println("Find link targets by text and ID")
+	o := testOutline()
+	if h := o.findTarget("a"); h == nil || h.ID != 2 {
+		t.Errorf("Fail: target 'a' wanted Headline 2 got %v\n", h)
+	}
+	if h := o.findTarget("4"); h == nil || h.ID != 4 {
+		t.Errorf("Fail: target '4' wanted Headline 4 got %v\n", h)
+	}
+	if h := o.findTarget(""); h == nil || h.ID != 1 {
+		t.Errorf("Fail: empty target wanted Headline 1 got %v\n", h)
+	}
+	if h := o.findTarget("missing"); h != nil {
+		t.Errorf("Fail: target 'missing' should not be found, got %d\n", h.ID)
+	}
+
+	fmt.Println("Backlinks are sorted by outline title then snippet")
+	li := linkIndex{
+		"zeta.gv":  {{"zeta.gv", "Zeta", 2, "second", link{outline: "Test"}}, {"zeta.gv", "Zeta", 3, "first", link{outline: "Test"}}},
+		"alpha.gv": {{"alpha.gv", "alpha", 2, "only", link{outline: "Test"}}},
+		"other.gv": {{"other.gv", "Other", 2, "elsewhere", link{outline: "Elsewhere"}}},
+	}
+	for i := 0; i < 5; i++ { // map order changes from run to run
+		refs := li.backlinksTo("test.gv", &Outline{Title: "Test"}, o.headlineIndex[2])
+		var got []string
+		for _, r := range refs {
+			got = append(got, r.snippet)
+		}
+		if fmt.Sprint(got) != "[only first second]" {
+			t.Fatalf("Fail: wanted backlinks [only first second] got %v\n", got)
+		}
+	}
+
+	fmt.Println("Forget the links in deleted outlines and Folders")
+	li[filepath.Join("dir", "a.gv")] = li["alpha.gv"]
+	li[filepath.Join("dir", "sub", "b.gv")] = li["alpha.gv"]
+	li["dirt.gv"] = li["alpha.gv"]
+	li.forget("zeta.gv")
+	li.forget("dir")
+	var paths []string
+	for path := range li {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if fmt.Sprint(paths) != "[alpha.gv dirt.gv other.gv]" {
+		t.Errorf("Fail: wanted links left for [alpha.gv dirt.gv other.gv] got %v\n", paths)
+	}
+
+	fmt.Println("Build the link index from the outline cache")
+	dir := t.TempDir()
+	storage := filepath.Join(dir, "outlines")
+	os.Mkdir(storage, 0700)
+	linking := newOutline("Linking")
+	id, _ := linking.addHeadline("see [[Test#B]]", -1)
+	buf, _ := json.Marshal(linking)
+	path := filepath.Join(storage, "linking.gv")
+	ioutil.WriteFile(path, buf, 0644)
+	cache := loadOutlineCache(dir, filepath.Join(dir, defaultCacheFilename))
+	li, err := buildLinkIndex(storage, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := li.backlinksTo("test.gv", &Outline{Title: "Test"}, o.headlineIndex[4]); len(refs) != 1 || refs[0].headlineID != id || refs[0].title != "Linking" {
+		t.Errorf("Fail: wanted the link from Linking got %v\n", refs)
+	}
+	cache = loadOutlineCache(dir, filepath.Join(dir, defaultCacheFilename))
+	cache.outlines["/outlines/linking.gv"].Links[0].Snippet = "cached" // so we can tell it wasn't read again
+	li, _ = buildLinkIndex(storage, cache)
+	if refs := li[path]; len(refs) != 1 || refs[0].snippet != "cached" {
+		t.Errorf("Fail: wanted the links of an unchanged outline from the saved cache got %v\n", refs)
+	}
+}
@@ -18,6 +18,7 @@ type config map[string]string
 var cfg config
 
 var currentFilename string
+var currentFileDirectory string // directory holding currentFilename
 
 var screenWidth int
 var screenHeight int
@@ -34,6 +35,10 @@ const tup = '\u2534'
 
 const dirtyFlag = '*'
 
+const scrollUpMarker = '\u25B2'   // there is more above
+const scrollDownMarker = '\u25BC' // there is more below
+const scrollThumb = '\u2503'
+
 const ellipsis = '\u2026'
 
 const htriangle = '\u25B6'
@@ -54,6 +59,9 @@ var buttonStyle tcell.Style
 var fileStyle tcell.Style
 var dirStyle tcell.Style
 var selectedStyle tcell.Style
+var noteStyle tcell.Style
+var linkStyle tcell.Style
+var codeColor tcell.Color
 
 var org *organizer
 var ed *editor
@@ -68,7 +76,7 @@ const lastOpenedOutlineCfgKey = "lastOpenedOutline"
 //go:embed help.txt
 var helptext string
 
-func drawFrame(s tcell.Screen, x, y, width, height int) {
+func drawFrame(s tcell.Screen, x, y, width, height int, title string) {
 	// Corners
 	s.SetContent(x, y, tlcorner, nil, defStyle)
 	s.SetContent(x+width-1, y, trcorner, nil, defStyle)
@@ -79,7 +87,7 @@ func drawFrame(s tcell.Screen, x, y, width, height int) {
 		s.SetContent(bx+x+1, y, hline, nil, defStyle)
 		s.SetContent(bx+x+1, y+height-1, hline, nil, defStyle)
 	}
-	writeString(s, x+2, y, "[Help]")
+	writeString(s, x+2, y, "["+title+"]")
 	// Vertical
 	for by := y + 1; by < y+height-1; by++ {
 		s.SetContent(x, by, vline, nil, defStyle)
@@ -108,7 +116,7 @@ func showHelp(s tcell.Screen) {
 	height := len(lines) + 2
 	x := (screenWidth - width) / 2
 	y := (screenHeight - height) / 2
-	drawFrame(s, x, y, width, height)
+	drawFrame(s, x, y, width, height, "Help")
 	for c, l := range lines {
 		writeString(s, x+2, y+c+1, l)
 	}
@@ -141,6 +149,47 @@ func drawBorder(s tcell.Screen, x, y, width, height int) {
 	}
 }
 
+// Draw a scrollbar in the border column at x for a list of total lines, visible of which are shown starting
+//  at top.  Markers at either end show there is more above or below, and the thumb between them shows how much of
+//  the list is shown (and where).  Just the border is drawn if everything fits.
+func drawScrollbar(s tcell.Screen, x int, total int, top int, visible int) {
+	height := screenHeight - 3 // the rows between the top and bottom borders
+	for y := 1; y <= height; y++ {
+		s.SetContent(x, y, vline, nil, borderStyle)
+	}
+	if total <= visible || height < 3 {
+		return
+	}
+	if top > 0 {
+		s.SetContent(x, 1, scrollUpMarker, nil, borderStyle)
+	}
+	if top+visible < total {
+		s.SetContent(x, height, scrollDownMarker, nil, borderStyle)
+	}
+	start, size := thumbFor(total, top, visible, height-2)
+	for y := start; y < start+size; y++ {
+		s.SetContent(x, 2+y, scrollThumb, nil, borderStyle)
+	}
+}
+
+// Where the scrollbar thumb starts within a track of length rows, and how long it is
+func thumbFor(total int, top int, visible int, length int) (int, int) {
+	if total <= visible {
+		return 0, length // everything is showing
+	}
+	size := clamp(length*visible/total, 1, length)
+	start := length * top / total
+	switch {
+	case top+visible >= total: // the end of the list is shown
+		start = length
+	case start+size >= length: // don't look like we're at the end when we aren't...
+		start = length - size - 1
+	case start == 0 && top > 0: // ...or at the start
+		start = 1
+	}
+	return clamp(start, 0, length-size), size // (a short track may not have room to show where we are)
+}
+
 // Render and re-draw the top border
 func drawTopBorder(s tcell.Screen) {
 	tb := renderTopBorder()
@@ -155,7 +204,7 @@ func renderTopBorder() *[]rune {
 	maxTitleWidth := int(float64(ed.editorWidth) * 0.8) // Set maximum title size so we don't run over
 
 	// Organizer
-	foldername := []rune(filepath.Base(org.currentName)) // TODO: Ensure this is < org.width-3
+	foldername := []rune(filepath.Base(org.label())) // TODO: Ensure this is < org.width-3
 	if len(foldername) > org.width-3 {
 		foldername = foldername[:org.width-4]
 		foldername = append(foldername, ellipsis)
@@ -189,15 +238,28 @@ func renderTopBorder() *[]rune {
 	return &row
 }
 
+// Render and re-draw the bottom border (with the latest outline stats)
+func drawBottomBorder(s tcell.Screen) {
+	bb := renderBottomBorder(screenWidth - 2)
+	for bx := 0; bx < len(*bb); bx++ {
+		s.SetContent(bx+1, screenHeight-2, (*bb)[bx], nil, borderStyle)
+	}
+}
+
 func renderBottomBorder(width int) *[]rune {
 	var row []rune
 	for p := 1; p < org.width+1; p++ {
 		row = append(row, hline)
 	}
 	row = append(row, tup)
+	// Editor stats at the right, as [...] with a line either side
+	stats := []rune(ed.stats().text(screenWidth - 2 - len(row) - 4))
 	for p := len(row); p < screenWidth-2; p++ {
 		row = append(row, hline)
 	}
+	if len(stats) > 0 {
+		copy(row[len(row)-len(stats)-3:], []rune("["+string(stats)+"]"))
+	}
 	return &row
 }
 
@@ -243,8 +305,15 @@ func renderPrompt(s tcell.Screen, cx int, msg string, response string) {
 
 // Prompt the user for some input- blocking main event loop
 func prompt(s tcell.Screen, msg string) string {
-	var response []rune
-	var cursX int = len(msg) + 1
+	response, _ := editPrompt(s, msg, "")
+	return response
+}
+
+// Prompt the user to edit value- blocking main event loop.  Returns the edited value and false if the user gave
+//  up (with ESC) instead.
+func editPrompt(s tcell.Screen, msg string, value string) (string, bool) {
+	response := []rune(value)
+	var cursX int = len(msg) + 1 + len(response)
 	for {
 		renderPrompt(s, cursX, msg, string(response))
 		switch ev := s.PollEvent().(type) {
@@ -264,10 +333,10 @@ func prompt(s tcell.Screen, msg string) string {
 				}
 			case tcell.KeyEnter:
 				clearPrompt(s)
-				return string(response)
+				return string(response), true
 			case tcell.KeyEscape:
 				clearPrompt(s)
-				return ""
+				return "", false
 			}
 		}
 	}
@@ -371,6 +440,15 @@ func setColors() {
 	selectedStyle = tcell.StyleDefault.
 		Background(colorFor("defaultTextColor")).
 		Foreground(colorFor("backgroundColor"))
+
+	noteStyle = defStyle.Dim(true)
+
+	linkStyle = tcell.StyleDefault.
+		Background(colorFor("backgroundColor")).
+		Foreground(colorFor("linkColor")).
+		Underline(true)
+
+	codeColor = colorFor("listColor")
 }
 
 func main() {
@@ -412,6 +490,7 @@ func main() {
 		fmt.Printf("Unable to create organizer: %v\n", err)
 		os.Exit(1)
 	}
+	go org.cache.rebuild(org.directory) // bring the outline cache up to date in the background
 	ed = newEditor(s, org)
 	org.refresh(s)
 
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScrollbar(t *testing.T) {
+
+	for _, test := range []struct {
+		total, top, visible, length int
+		start, size                 int
+	}{
+		{30, 0, 10, 10, 0, 3},    // at the start
+		{30, 20, 10, 10, 7, 3},   // at the end
+		{30, 10, 10, 10, 3, 3},   // in the middle
+		{300, 1, 10, 10, 1, 1},   // just off the start
+		{300, 289, 10, 10, 8, 1}, // just short of the end
+		{300, 290, 10, 10, 9, 1},
+		{11, 1, 10, 10, 1, 9},
+		{30, 0, 10, 1, 0, 1}, // a track one row long (in a 3 row window)
+		{30, 10, 10, 1, 0, 1},
+		{30, 20, 10, 1, 0, 1},
+		{30, 0, 10, 2, 0, 1}, // two rows long
+		{30, 10, 10, 2, 1, 1},
+		{30, 20, 10, 2, 1, 1},
+		{30, 0, 10, 3, 0, 1}, // three rows long
+		{30, 10, 10, 3, 1, 1},
+		{30, 20, 10, 3, 2, 1},
+		{5, 0, 10, 1, 0, 1}, // everything is showing
+		{5, 0, 10, 2, 0, 2},
+		{10, 0, 10, 3, 0, 3},
+		{0, 0, 10, 3, 0, 3},
+	} {
+		fmt.Printf("Scrollbar thumb for %d of %d from %d in %d rows\n", test.visible, test.total, test.top, test.length)
+		if start, size := thumbFor(test.total, test.top, test.visible, test.length); start != test.start || size != test.size {
+			t.Errorf("Fail: wanted thumb at %d (%d long) got %d (%d long)\n", test.start, test.size, start, size)
+		}
+	}
+}
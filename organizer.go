@@ -31,28 +31,60 @@ Enter on a folder opens that folder to display the *.gv/folders inside.  Topmost
 Delete pressed on an outline prompts for its removal. Removing an outline means the file is deleted and the Organizer is refreshed.
 Delete on a folder does nothing.
 
+Folders can be renamed (CTRL-R) and given a description, color and icon (CTRL-E).  Folders and outlines can be moved
+into another Folder (CTRL-T).  See folders.go.
+
+Outlines can be copied, cut and pasted between Folders with CTRL-C/CTRL-X/CTRL-V (see organizer_clipboard.go).
+
+Titles (and #tags and the words in Notes, for searching with '/') come from the outline cache rather than the
+outlines themselves (see cache.go).
+
 */
 
 type organizer struct {
-	baseDir          string       // base directory for gv's config and data files
-	directory        string       // where is Organizer looking for outline files?
-	currentDirectory string       // what directory are we currently in?
-	currentName      string       // name of the current directory (from metadata)
-	width            int          // width of the Organizer
-	height           int          // height of the Organizer
-	folderIndex      *FolderIndex // index of all Folder metadata
-	indexFilePath    string       // filepath to the folder index file
-	entries          []*entry     // the current list of entry values for current folder
-	currentLine      int          // the current position within the list of outlines
-	topLine          int          // index of the topmost outline of the Organizer
-	inFocus          bool         // Is the organizer currently in focus?
+	baseDir          string         // base directory for gv's config and data files
+	directory        string         // where is Organizer looking for outline files?
+	currentDirectory string         // what directory are we currently in?
+	currentName      string         // name of the current directory (from metadata)
+	width            int            // width of the Organizer
+	height           int            // height of the Organizer
+	folderIndex      *FolderIndex   // index of all Folder metadata
+	indexFilePath    string         // filepath to the folder index file
+	entries          []*entry       // the current list of entry values for current folder
+	currentLine      int            // the current position within the list of outlines
+	topLine          int            // index of the topmost outline of the Organizer
+	inFocus          bool           // Is the organizer currently in focus?
+	mode             organizerMode  // what are we listing?
+	savedLine        int            // currentLine of the folder listing while we are in another mode
+	savedTop         int            // topLine of the folder listing while we are in another mode
+	links            linkIndex      // index of all links between outlines (nil until first needed)
+	moving           string         // full path of the Folder or outline being moved (while in moveMode)
+	clipboard        string         // full path of the outline copied or cut ("" if none)
+	clipboardCut     bool           // was the outline on the clipboard cut (i.e. it is being moved, not copied)?
+	lastPaste        *pastedOutline // the last outline pasted (nil if there is nothing to undo)
+	cache            *outlineCache  // what we know about each outline (so we don't have to read them all)
+	query            string         // what we searched for (in searchMode)
 }
 
+// The Organizer normally lists the current folder, but can temporarily list other things instead
+type organizerMode int
+
+const (
+	folderMode    organizerMode = iota // outlines and folders in the current directory
+	backlinksMode                      // Headlines linking to the editor's current Headline
+	moveMode                           // Folders that the selected Folder or outline could be moved to
+	searchMode                         // outlines (in any Folder) whose titles, #tags or Notes match a search
+	recentMode                         // the outlines opened most recently
+)
+
 // one line in the organizer window (either a Folder or an outline file)
 type entry struct {
-	name     string
-	filename string
-	isDir    bool
+	name       string
+	filename   string // file or directory name (full path to the outline for a backlink)
+	isDir      bool
+	headlineID int          // Headline to jump to when opening a backlink
+	folder     *Folder      // metadata of a Folder (nil for outlines and "..")
+	info       *outlineInfo // what we know about an outline (nil for Folders)
 }
 
 // Metadata for our Folders - map key is fully qualified pathname to the Folder's directory
@@ -60,12 +92,14 @@ type entry struct {
 type FolderIndex map[string]*Folder
 
 type Folder struct {
-	Name string
-	// TODO: Add some more metadata someday
+	Name        string
+	Description string `json:",omitempty"` // shown after the Name
+	Color       string `json:",omitempty"` // tcell color name to show the Folder in ("" for the default)
+	Icon        string `json:",omitempty"` // shown before the Name
 }
 
 func newEntry(n string, f string, d bool) *entry {
-	return &entry{n, f, d}
+	return &entry{n, f, d, 0, nil, nil}
 }
 
 func newOrganizer(baseDir string, storageDir string) (*organizer, error) {
@@ -77,7 +111,9 @@ func newOrganizer(baseDir string, storageDir string) (*organizer, error) {
 			return nil, err
 		}
 	}
-	return &organizer{baseDir, storageDir, storageDir, "outlines", 0, 0, fi, indexFilePath, nil, 0, 0, false}, nil
+	cache := loadOutlineCache(baseDir, filepath.Join(baseDir, defaultCacheFilename))
+	return &organizer{baseDir, storageDir, storageDir, "outlines", 0, 0, fi, indexFilePath, nil, 0, 0, false,
+		folderMode, 0, 0, nil, "", "", false, nil, cache, ""}, nil
 }
 
 // Try to load the FolderIndex from the file
@@ -103,7 +139,7 @@ func createFolderIndex(filename string, baseDir string, storageDir string) (*Fol
 				return err
 			}
 			if info.IsDir() {
-				fi[strings.TrimPrefix(path, baseDir)] = &Folder{info.Name()} // makes a relative path
+				fi[strings.TrimPrefix(path, baseDir)] = &Folder{Name: info.Name()} // makes a relative path
 			}
 			return nil
 		})
@@ -169,56 +205,101 @@ func (org *organizer) readDirectory() ([]*entry, error) {
 	for _, info := range files {
 		if info.Mode().IsRegular() {
 			if strings.HasSuffix(info.Name(), ".gv") {
-				title, err := org.getTitleFrom(filepath.Join(org.currentDirectory, info.Name()))
+				cached, err := org.cache.infoFor(filepath.Join(org.currentDirectory, info.Name()), info)
 				if err != nil {
 					return nil, err
 				}
-				outlines = append(outlines, newEntry(title, info.Name(), false))
+				e := newEntry(cached.title(), info.Name(), false)
+				e.info = cached
+				outlines = append(outlines, e)
 			}
 		} else if info.Mode().IsDir() && !strings.HasPrefix(info.Name(), ".") {
 			// Look up the Folder metadata so we can render the human-readablet title instead of the filename
-			theDir := strings.TrimPrefix(org.currentDirectory, org.baseDir)
-			folder, found := (*org.folderIndex)[filepath.Join(theDir, info.Name())]
-			var name string
-			if !found {
-				name = "FOLDER NOT FOUND IN INDEX"
-			} else {
-				name = folder.Name
-			}
-			folders = append(folders, newEntry(name, info.Name(), true))
+			folder := org.folderFor(filepath.Join(org.currentDirectory, info.Name()))
+			e := newEntry(folder.Name, info.Name(), true)
+			e.folder = folder
+			folders = append(folders, e)
 		}
 	}
+	org.cache.save() // anything we had to read is cached for next time
 	// Sort everything nicely
 	sort.Slice(folders, func(i, j int) bool { return folders[i].name < folders[j].name })
-	sort.Slice(outlines, func(i, j int) bool { return outlines[i].name < outlines[j].name })
+	sortOutlines(outlines, org.currentDirectory)
 	// Put it together
 	result := []*entry{}
 	if filepath.Clean(org.currentDirectory) != filepath.Clean(org.directory) { // we are in a child folder
 		result = append(result, newEntry("..", "..", true))
+	} else if len(pathList(recentCfgKey)) > 0 {
+		result = append(result, newEntry("Recent", recentFilename, true))
 	}
 	result = append(result, folders...)
 	result = append(result, outlines...)
 	return result, nil
 }
 
-// peek inside the outline file and return the Title field
-// TODO: This could be very slow for large numbers of outlines...how can we do this w/out unmarshaling entire outline?
-func (org *organizer) getTitleFrom(filename string) (string, error) {
-	buf, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return "", err
+// Temporarily list something other than the current folder
+func (org *organizer) enterMode(mode organizerMode, entries []*entry) {
+	if org.mode == folderMode {
+		org.savedLine = org.currentLine
+		org.savedTop = org.topLine
 	}
-	// Extract the outline JSON
-	var out Outline
-	err = json.Unmarshal(buf, &out)
-	if err != nil {
-		return "", err
+	org.mode = mode
+	org.entries = entries
+	org.currentLine = 0
+	org.topLine = 0
+}
+
+// Go back to listing the current folder
+func (org *organizer) leaveMode(s tcell.Screen) {
+	if org.mode != folderMode {
+		org.mode = folderMode
+		org.currentLine = org.savedLine
+		org.topLine = org.savedTop
+		org.refresh(s)
+		if org.currentLine >= len(org.entries) {
+			org.currentLine = 0
+			org.topLine = 0
+		}
 	}
-	result := "no title"
-	if out.Title != "" {
-		result = out.Title
+}
+
+// What should the top border call the current listing?
+func (org *organizer) label() string {
+	switch org.mode {
+	case backlinksMode:
+		return "Backlinks"
+	case moveMode:
+		return "Move to"
+	case searchMode:
+		return "Search: " + org.query
+	case recentMode:
+		return "Recent"
 	}
-	return result, nil
+	if order := currentSortOrder(); order != byTitle {
+		return org.currentName + " (by " + string(order) + ")"
+	}
+	return org.currentName
+}
+
+// List the outlines (in any Folder) whose titles, #tags or Notes match
+func (org *organizer) search(s tcell.Screen) {
+	query := prompt(s, "Search titles, #tags and Notes: ")
+	if strings.TrimSpace(query) == "" {
+		return
+	}
+	results := []*entry{}
+	for path, info := range org.cache.search(query) {
+		e := newEntry(info.title(), path, false)
+		e.info = info
+		results = append(results, e)
+	}
+	if len(results) == 0 {
+		prompt(s, fmt.Sprintf("Nothing matches %s", query))
+		return
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].name < results[j].name })
+	org.query = query
+	org.enterMode(searchMode, results)
 }
 
 // Clear out the contents of the organizer's window
@@ -237,26 +318,36 @@ func (org *organizer) draw(s tcell.Screen) {
 	org.height = screenHeight - 2 // TODO: TAKE THIS OUT & MOVE TO setScrenSize() ?
 	width := org.width - 1
 	y := 1
+	pinned := pinnedPaths()
 	for c := org.topLine; c < len(org.entries); c++ {
 		if y < org.height {
+			entry := org.entries[c]
 			style := fileStyle
 			if org.inFocus && c == org.currentLine {
 				style = selectedStyle
-			} else if org.entries[c].isDir {
+			} else if entry.isDir {
 				style = dirStyle
-			}
-			// Write out the entry name
-			for x, r := range org.entries[c].name {
-				if x < width {
-					if x == width-1 { // probably will go over width of organizer, just use an ellipsis
-						r = ellipsis
-					}
-					s.SetContent(1+x, y, r, nil, style)
+				if entry.folder != nil && entry.folder.Color != "" {
+					style = style.Foreground(tcell.ColorNames[entry.folder.Color])
 				}
+			} else {
+				style = org.clipboardStyle(entry, style)
+			}
+			name := entry.name
+			if entry.folder != nil && entry.folder.Icon != "" {
+				name = entry.folder.Icon + " " + name
+			} else if !entry.isDir && pinned[org.entryPath(entry)] {
+				name = string(pinGlyph) + " " + name
+			}
+			// Write out the entry name (with an ellipsis if it would go over width of organizer)
+			used := drawText(s, 1, y, name, width, style)
+			if entry.folder != nil && entry.folder.Description != "" && used+2 < width {
+				drawText(s, 1+used+2, y, entry.folder.Description, width-used-2, noteStyle)
 			}
 		}
 		y++
 	}
+	drawScrollbar(s, org.width+1, len(org.entries), org.topLine, org.height-1)
 	s.Show()
 }
 
@@ -264,14 +355,40 @@ func (org *organizer) draw(s tcell.Screen) {
 // Return whether or not we should release Organizer focus
 func (org *organizer) entrySelected(s tcell.Screen) bool {
 	entry := org.entries[org.currentLine]
+	if org.mode == backlinksMode {
+		from := linkLocation{ed.filePath(), ed.currentHeadlineID, ed.currentPosition}
+		if entry.filename == ed.filePath() || ed.openAt(s, entry.filename) {
+			if h := ed.out.findHeadline(entry.headlineID); h != nil {
+				ed.linkHistory = append(ed.linkHistory, from)
+				ed.moveToHeadline(h, 0)
+			}
+		}
+		org.leaveMode(s)
+		return true
+	}
+	if org.mode == searchMode || (org.mode == recentMode && entry.filename != "..") {
+		ed.open(s, entry.filename)
+		return true
+	}
+	if org.mode == recentMode { // ".." takes us back to the root Folder
+		org.leaveMode(s)
+		drawTopBorder(s)
+		return false
+	}
+	if entry.filename == recentFilename {
+		org.showRecent()
+		drawTopBorder(s)
+		return false
+	}
+	if org.mode == moveMode {
+		org.moveTo(s, entry.filename)
+		org.leaveMode(s)
+		drawScreen(s)
+		return false
+	}
 	if entry.isDir {
 		org.currentDirectory = filepath.Join(org.currentDirectory, entry.filename)
-		/*
-			TODO: Bug here when entry.name = "..", we need to set it to the parent's name.
-				Perhaps in that case we need to generate the necessary key in folderIndex and
-				pull the name from that?
-		*/
-		org.currentName = entry.name
+		org.currentName = org.folderFor(org.currentDirectory).Name // (entry.name is ".." when going back up)
 		org.clear(s)
 		org.refresh(s)
 		drawTopBorder(s)
@@ -285,25 +402,31 @@ func (org *organizer) entrySelected(s tcell.Screen) bool {
 func (org *organizer) newFolder(s tcell.Screen) {
 	f := prompt(s, "Enter new Folder name: ")
 	if f != "" {
-		fileName := generateFilename(f, "")
-		filePath := filepath.Join(org.currentDirectory, fileName)
-		err := os.Mkdir(filePath, 0700)
-		if err != nil {
+		if _, err := org.makeFolder(org.currentDirectory, generateFilename(f, ""), f); err != nil {
 			msg := fmt.Sprintf("Error creating directory %s; %v", f, err)
 			prompt(s, msg)
-		} else {
-			key := strings.TrimPrefix(filePath, org.baseDir)
-			(*org.folderIndex)[key] = &Folder{f} // Add new folder to metadata index
-			org.currentName = f
-			org.saveFolderIndex()
 		}
 		org.clear(s)
 		org.refresh(s)
 	}
 }
 
+// Create a Folder called name (in directory fileName) within parent.  Returns the path to the new directory.
+func (org *organizer) makeFolder(parent string, fileName string, name string) (string, error) {
+	filePath := filepath.Join(parent, fileName)
+	if err := os.Mkdir(filePath, 0700); err != nil {
+		return "", err
+	}
+	key := strings.TrimPrefix(filePath, org.baseDir)
+	(*org.folderIndex)[key] = &Folder{Name: name} // Add new folder to metadata index
+	return filePath, org.saveFolderIndex()
+}
+
 func (org *organizer) deleteSelected(s tcell.Screen) {
 	entry := org.entries[org.currentLine]
+	if entry.filename == ".." || entry.filename == recentFilename {
+		return
+	}
 	msg := fmt.Sprintf("Delete %s (Y/N)?", entry.name)
 	proceed := false
 	response := prompt(s, msg)
@@ -323,8 +446,7 @@ func (org *organizer) deleteSelected(s tcell.Screen) {
 		}
 		if proceed {
 			thefile := filepath.Join(org.currentDirectory, entry.filename)
-			err := os.RemoveAll(thefile)
-			if err != nil {
+			if err := org.remove(thefile, entry.isDir); err != nil {
 				msg := fmt.Sprintf("Error removing %s; %v", thefile, err)
 				prompt(s, msg)
 			}
@@ -334,6 +456,21 @@ func (org *organizer) deleteSelected(s tcell.Screen) {
 	}
 }
 
+// Delete the outline (or Folder) at path.  Only once it is gone do we forget about it (in the Folder index,
+//  pins, recents and link index).
+func (org *organizer) remove(path string, isDir bool) error {
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	if isDir {
+		org.folderIndex.remove(org.folderKey(path))
+		org.saveFolderIndex()
+	}
+	renamePaths(path, "")
+	org.links.forget(path)
+	return nil
+}
+
 func (org *organizer) dump() {
 	out := fmt.Sprintf("%v\ncurrentLine %d  currentDirectory %s   directory %s\n",
 		org.entries, org.currentLine, org.currentDirectory, org.directory)
@@ -383,23 +520,99 @@ func (org *organizer) handleEvents(s tcell.Screen, o *Outline) {
 					os.Exit(0)
 				}
 			case tcell.KeyCtrlO:
+				if org.mode != folderMode {
+					break
+				}
 				ed.newOutline(s, "")
 				org.refresh(s)
 				org.draw(s)
 				done = true
 			case tcell.KeyCtrlF:
+				if org.mode != folderMode {
+					break
+				}
 				org.newFolder(s)
 				org.draw(s)
 			case tcell.KeyCtrlD:
+				if org.mode != folderMode {
+					break
+				}
 				org.deleteSelected(s)
 				org.draw(s)
+			case tcell.KeyCtrlR:
+				if org.mode != folderMode {
+					break
+				}
+				org.renameSelected(s)
+				drawScreen(s)
+			case tcell.KeyCtrlE:
+				if org.mode != folderMode {
+					break
+				}
+				org.editSelected(s)
+				org.draw(s)
+			case tcell.KeyCtrlC, tcell.KeyCtrlX:
+				if org.mode != folderMode {
+					break
+				}
+				org.copySelected(s, ev.Key() == tcell.KeyCtrlX)
+				org.draw(s)
+			case tcell.KeyCtrlV:
+				if org.mode != folderMode {
+					break
+				}
+				org.paste(s)
+				drawScreen(s)
+			case tcell.KeyCtrlZ:
+				if org.mode != folderMode {
+					break
+				}
+				org.undoPaste(s)
+				drawScreen(s)
+			case tcell.KeyRune:
+				switch {
+				case ev.Rune() == '/' && org.mode != moveMode:
+					org.search(s)
+					drawScreen(s)
+				case ev.Rune() == 's' && org.mode == folderMode:
+					org.nextSortOrder(s)
+					drawScreen(s)
+				case ev.Rune() == 'p' && org.mode != moveMode && org.mode != backlinksMode:
+					org.togglePin(s)
+					org.draw(s)
+				}
+			case tcell.KeyCtrlT:
+				if org.mode != folderMode {
+					break
+				}
+				org.chooseMoveDestination(s)
+				drawScreen(s)
 			case tcell.KeyCtrlP:
+				if ed.quickOpen(s) {
+					org.leaveMode(s)
+					done = true
+				}
+				drawScreen(s)
+			case tcell.KeyF2:
+				if ed.openTodaysJournal(s) {
+					org.leaveMode(s)
+					done = true
+				}
+				drawScreen(s)
+			case tcell.KeyF12: // for debugging
 				org.dump()
 			case tcell.KeyF1:
 				showHelp(s)
 				prompt(s, "")
 				drawScreen(s)
 			case tcell.KeyEscape:
+				if org.mode == moveMode || org.mode == searchMode || org.mode == recentMode { // back to the Folder we came from
+					org.moving = ""
+					org.leaveMode(s)
+					drawScreen(s)
+					break
+				}
+				org.leaveMode(s)
 				done = true
 			}
 		}
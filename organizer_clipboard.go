@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+Copying (CTRL-C), cutting (CTRL-X) and pasting (CTRL-V) outlines between Folders in the Organizer.  A copied
+outline is shown in a different color, a cut one is dimmed until it is pasted somewhere.
+
+Pasting a copy writes a new file (with a new name, " (copy)" added to its title and new UIDs for its Headlines so
+links still lead to the original).  Pasting after a cut moves the file.  CTRL-Z undoes the last paste.
+
+*/
+
+// an outline pasted into a Folder, remembered so the paste can be undone
+type pastedOutline struct {
+	path string // where the outline is now
+	from string // where it was moved from ("" if it is a copy)
+}
+
+// Put the selected outline on the Organizer's clipboard
+func (org *organizer) copySelected(s tcell.Screen, cut bool) {
+	entry := org.entries[org.currentLine]
+	if entry.isDir {
+		prompt(s, "Only outlines can be copied (use CTRL-T to move a Folder)")
+		return
+	}
+	org.clipboard = filepath.Join(org.currentDirectory, entry.filename)
+	org.clipboardCut = cut
+}
+
+// Paste the outline on the clipboard into the current Folder
+func (org *organizer) paste(s tcell.Screen) {
+	if org.clipboard == "" {
+		return
+	}
+	var pasted *pastedOutline
+	var err error
+	if org.clipboardCut {
+		pasted, err = org.pasteMove(org.clipboard, org.currentDirectory)
+		if err == nil {
+			org.clipboard = "" // it's not where it was any more
+		}
+	} else {
+		pasted, err = pasteCopy(org.clipboard, org.currentDirectory)
+		if err == nil {
+			org.links = nil // the copy's links aren't in the link index yet, so rebuild it when it is next needed
+		}
+	}
+	if err != nil {
+		prompt(s, fmt.Sprintf("Unable to paste %s; %v", filepath.Base(org.clipboard), err))
+		return
+	}
+	org.lastPaste = pasted
+	org.refresh(s)
+	org.selectPath(pasted.path) // select what we just pasted
+}
+
+// Move the outline at source into dir
+func (org *organizer) pasteMove(source string, dir string) (*pastedOutline, error) {
+	target := filepath.Join(dir, filepath.Base(source))
+	if target == source {
+		return nil, fmt.Errorf("it is already in this Folder")
+	}
+	if err := org.moveFile(source, target); err != nil {
+		return nil, err
+	}
+	return &pastedOutline{target, source}, nil
+}
+
+// Move a file without replacing anything already at target, keeping track of the outline being edited
+func (org *organizer) moveFile(source string, target string) error {
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("%s already exists", target)
+	}
+	if err := os.Rename(source, target); err != nil {
+		return err
+	}
+	org.links = nil // the link index is keyed by filepath, so rebuild it when it is next needed
+	renamePaths(source, target)
+	ed.fileMoved(source, target)
+	return nil
+}
+
+// Write a copy of the outline at source into dir
+func pasteCopy(source string, dir string) (*pastedOutline, error) {
+	out, err := loadOutline(source)
+	if err != nil {
+		return nil, err
+	}
+	out.migrate()
+	out.Title = strings.TrimSpace(out.Title + " (copy)")
+	out.walk(func(h *Headline, level int) {
+		h.UID = newUID()
+	})
+	buf, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	target := filepath.Join(dir, generateFilename(out.Title, ".gv"))
+	if err := ioutil.WriteFile(target, buf, 0644); err != nil {
+		return nil, err
+	}
+	return &pastedOutline{target, ""}, nil
+}
+
+// Undo the last paste- remove the copy, or move the outline back to where it was cut from
+func (org *organizer) undoPaste(s tcell.Screen) {
+	pasted := org.lastPaste
+	if pasted == nil {
+		return
+	}
+	var err error
+	if pasted.from == "" {
+		if pasted.path == ed.filePath() {
+			err = fmt.Errorf("it is open in the Editor")
+		} else {
+			if err = os.Remove(pasted.path); err == nil {
+				delete(org.links, pasted.path)
+			}
+		}
+	} else {
+		err = org.moveFile(pasted.path, pasted.from)
+	}
+	if err != nil {
+		prompt(s, fmt.Sprintf("Unable to undo paste of %s; %v", filepath.Base(pasted.path), err))
+		return
+	}
+	org.lastPaste = nil
+	org.refresh(s)
+	if org.currentLine >= len(org.entries) {
+		org.currentLine = len(org.entries) - 1
+	}
+}
+
+// The style for an entry that is on the clipboard (or style if it isn't)
+func (org *organizer) clipboardStyle(entry *entry, style tcell.Style) tcell.Style {
+	if org.mode != folderMode || entry.isDir || filepath.Join(org.currentDirectory, entry.filename) != org.clipboard {
+		return style
+	}
+	if org.clipboardCut {
+		return style.Dim(true)
+	}
+	return style.Foreground(colorFor("linkColor"))
+}
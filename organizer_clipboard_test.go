@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOrganizerClipboard(t *testing.T) {
+
+	fmt.Println("Paste a copy of an outline")
+	dir := t.TempDir()
+	other := filepath.Join(dir, "other")
+	os.Mkdir(other, 0700)
+	o := newOutline("Plans")
+	id, _ := o.addHeadline("One", -1)
+	buf, _ := json.Marshal(o)
+	source := filepath.Join(dir, "plans.gv")
+	if err := ioutil.WriteFile(source, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pasted, err := pasteCopy(source, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := loadOutline(pasted.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.Title != "Plans (copy)" || pasted.from != "" || filepath.Dir(pasted.path) != other {
+		t.Errorf("Fail: wanted a copy titled Plans (copy) in other, got %s at %s\n", copied.Title, pasted.path)
+	}
+	if copied.headlineIndex[id].UID == o.headlineIndex[id].UID {
+		t.Errorf("Fail: a copy should get new UIDs\n")
+	}
+
+	fmt.Println("Cut and paste moves the outline (and undo moves it back)")
+	cfg = make(config)
+	currentFileDirectory = dir
+	currentFilename = "plans.gv"
+	org := &organizer{clipboard: source, clipboardCut: true, currentDirectory: other, cache: loadOutlineCache(dir, filepath.Join(dir, defaultCacheFilename))}
+	pasted, err = org.pasteMove(source, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(other, "plans.gv")); err != nil {
+		t.Errorf("Fail: plans.gv was not moved; %v\n", err)
+	}
+	if currentFileDirectory != other || cfg[lastOpenedOutlineCfgKey] != pasted.path {
+		t.Errorf("Fail: the open outline moved but the editor still has %s\n", currentFileDirectory)
+	}
+	if _, err := org.pasteMove(pasted.path, other); err == nil {
+		t.Errorf("Fail: pasting into the same Folder should fail\n")
+	}
+	org.lastPaste = pasted
+	org.undoPaste(nil)
+	if _, err := os.Stat(source); err != nil || currentFileDirectory != dir || org.lastPaste != nil {
+		t.Errorf("Fail: undo should move plans.gv back; %v\n", err)
+	}
+
+	fmt.Println("Undoing a copy takes its links out of the link index")
+	pasted, err = pasteCopy(source, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	org.links = linkIndex{pasted.path: {{pasted.path, "Plans (copy)", id, "One", link{outline: "Elsewhere"}}}}
+	org.lastPaste = pasted
+	org.undoPaste(nil)
+	if _, err := os.Stat(pasted.path); err == nil || len(org.links) != 0 {
+		t.Errorf("Fail: undo should remove the copy and its links, got %v\n", org.links)
+	}
+	currentFileDirectory = ""
+	currentFilename = ""
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+How the Organizer orders what it lists.
+
+Outlines are sorted by title, last modified, last opened or size ('s' switches between them).  Pinned outlines
+('p' pins or unpins one) always come first within their Folder.  Folders are always sorted by name.
+
+The root Folder also lists a "Recent" Folder holding the outlines opened most recently.  It isn't a real directory-
+the outlines in it are still in their own Folders.
+
+The sort order, pins and recent outlines are kept in gv.conf.  Pins and recent outlines are lists of full paths,
+kept as JSON arrays (so a path can hold any character).  Lists separated by the OS path list separator, as kept by
+older versions, are still read.
+
+*/
+
+const sortOrderCfgKey = "organizerSort"
+const pinnedCfgKey = "pinnedOutlines"
+const recentCfgKey = "recentOutlines"
+
+const maxRecent = 20
+
+const recentFilename = "*recent*" // stands in for the Recent Folder's directory (can't clash with a real one)
+
+const pinGlyph = '★'
+
+type sortOrder string
+
+const (
+	byTitle    sortOrder = "title"
+	byModified sortOrder = "modified"
+	byOpened   sortOrder = "opened"
+	bySize     sortOrder = "size"
+)
+
+var sortOrders = []sortOrder{byTitle, byModified, byOpened, bySize}
+
+// How outlines are currently sorted
+func currentSortOrder() sortOrder {
+	order := sortOrder(cfg[sortOrderCfgKey])
+	for _, o := range sortOrders {
+		if o == order {
+			return order
+		}
+	}
+	return byTitle
+}
+
+// Switch to the next sort order
+func (org *organizer) nextSortOrder(s tcell.Screen) {
+	order := currentSortOrder()
+	for i, o := range sortOrders {
+		if o == order {
+			order = sortOrders[(i+1)%len(sortOrders)]
+			break
+		}
+	}
+	cfg[sortOrderCfgKey] = string(order)
+	saveConfig()
+	org.refresh(s)
+}
+
+// Sort outlines (in dir) by the current sort order, then move the pinned ones to the top
+func sortOutlines(outlines []*entry, dir string) {
+	order := currentSortOrder()
+	opened := make(map[string]int) // how recently each outline was opened (lower is more recent)
+	for i, path := range pathList(recentCfgKey) {
+		opened[path] = i
+	}
+	rank := func(e *entry) int {
+		if r, found := opened[filepath.Join(dir, e.filename)]; found {
+			return r
+		}
+		return maxRecent // never opened (or not for a long time)
+	}
+	sort.SliceStable(outlines, func(i, j int) bool {
+		a, b := outlines[i], outlines[j]
+		switch {
+		case order == byModified && !a.info.ModTime.Equal(b.info.ModTime):
+			return a.info.ModTime.After(b.info.ModTime)
+		case order == byOpened && rank(a) != rank(b):
+			return rank(a) < rank(b)
+		case order == bySize && a.info.Size != b.info.Size:
+			return a.info.Size > b.info.Size
+		}
+		return a.name < b.name
+	})
+	pinned := pinnedPaths()
+	sort.SliceStable(outlines, func(i, j int) bool {
+		return pinned[filepath.Join(dir, outlines[i].filename)] && !pinned[filepath.Join(dir, outlines[j].filename)]
+	})
+}
+
+// A list of paths kept in gv.conf
+func pathList(key string) []string {
+	if cfg[key] == "" {
+		return nil
+	}
+	var paths []string
+	if err := json.Unmarshal([]byte(cfg[key]), &paths); err != nil {
+		return filepath.SplitList(cfg[key]) // kept by an older version
+	}
+	return paths
+}
+
+func setPathList(key string, paths []string) {
+	buf, err := json.Marshal(paths)
+	if err != nil {
+		return
+	}
+	cfg[key] = string(buf)
+	saveConfig()
+}
+
+// The set of pinned outline paths.  Build it once and look outlines up in it, rather than decoding the list in
+//  gv.conf for each one.
+func pinnedPaths() map[string]bool {
+	pinned := make(map[string]bool)
+	for _, p := range pathList(pinnedCfgKey) {
+		pinned[p] = true
+	}
+	return pinned
+}
+
+// Pin the selected outline (or unpin it if it is already pinned)
+func (org *organizer) togglePin(s tcell.Screen) {
+	entry := org.entries[org.currentLine]
+	if entry.isDir {
+		return
+	}
+	path := org.entryPath(entry)
+	pins := []string{}
+	wasPinned := false
+	for _, p := range pathList(pinnedCfgKey) {
+		if p != path {
+			pins = append(pins, p)
+		} else {
+			wasPinned = true
+		}
+	}
+	if !wasPinned {
+		pins = append(pins, path)
+	}
+	setPathList(pinnedCfgKey, pins)
+	if org.mode == folderMode {
+		org.refresh(s)
+		org.selectPath(path)
+	}
+}
+
+// Remember that the outline at path was just opened
+func addRecent(path string) {
+	recent := []string{path}
+	for _, p := range pathList(recentCfgKey) {
+		if p != path && len(recent) < maxRecent {
+			recent = append(recent, p)
+		}
+	}
+	setPathList(recentCfgKey, recent)
+}
+
+// The outline (or Folder) at from has moved to to (or been deleted, if to is "").  Update any pins and recent
+//  outlines at or beneath from.
+func renamePaths(from string, to string) {
+	for _, key := range []string{pinnedCfgKey, recentCfgKey} {
+		paths := []string{}
+		changed := false
+		for _, p := range pathList(key) {
+			if p == from || strings.HasPrefix(p, from+string(filepath.Separator)) {
+				changed = true
+				if to == "" {
+					continue
+				}
+				p = to + strings.TrimPrefix(p, from)
+			}
+			paths = append(paths, p)
+		}
+		if changed {
+			setPathList(key, paths)
+		}
+	}
+}
+
+// List the outlines opened most recently (that are still there)
+func (org *organizer) showRecent() {
+	entries := []*entry{newEntry("..", "..", true)}
+	for _, path := range pathList(recentCfgKey) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		info, err := org.cache.infoFor(path, fi)
+		if err != nil {
+			continue
+		}
+		e := newEntry(info.title(), path, false)
+		e.info = info
+		entries = append(entries, e)
+	}
+	org.enterMode(recentMode, entries)
+	org.currentLine = 1 // the most recent outline rather than ".."
+	if len(entries) == 1 {
+		org.currentLine = 0
+	}
+}
+
+// The full path to an entry's outline or Folder (entries in other modes already have full paths)
+func (org *organizer) entryPath(e *entry) string {
+	if filepath.IsAbs(e.filename) {
+		return e.filename
+	}
+	return filepath.Join(org.currentDirectory, e.filename)
+}
+
+// Put the cursor on the entry for path (if it is listed)
+func (org *organizer) selectPath(path string) {
+	for i, e := range org.entries {
+		if org.entryPath(e) == path {
+			org.currentLine = i
+		}
+	}
+	if org.currentLine < org.topLine {
+		org.topLine = org.currentLine
+	}
+	if org.currentLine-org.topLine+1 >= org.height { // Scroll?
+		org.topLine = org.currentLine - org.height + 2
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOrganizerSort(t *testing.T) {
+	cfg = make(config)
+	dir := "/gv/outlines"
+	now := time.Now()
+	outline := func(title string, file string, age int, size int64) *entry {
+		e := newEntry(title, file, false)
+		e.info = &outlineInfo{Title: title, ModTime: now.Add(-time.Duration(age) * time.Hour), Size: size}
+		return e
+	}
+	names := func(entries []*entry) string {
+		var n []string
+		for _, e := range entries {
+			n = append(n, e.name)
+		}
+		return fmt.Sprint(n)
+	}
+	outlines := []*entry{outline("b", "b.gv", 3, 10), outline("a", "a.gv", 2, 30), outline("c", "c.gv", 1, 20)}
+	addRecent(filepath.Join(dir, "a.gv"))
+	addRecent(filepath.Join(dir, "b.gv"))
+
+	for _, test := range []struct {
+		order  sortOrder
+		wanted string
+	}{
+		{byTitle, "[a b c]"},
+		{byModified, "[c a b]"},
+		{byOpened, "[b a c]"},
+		{bySize, "[a c b]"},
+	} {
+		fmt.Printf("Sort by %s\n", test.order)
+		cfg[sortOrderCfgKey] = string(test.order)
+		sortOutlines(outlines, dir)
+		if names(outlines) != test.wanted {
+			t.Errorf("Fail: sorting by %s wanted %s got %s\n", test.order, test.wanted, names(outlines))
+		}
+	}
+
+	fmt.Println("Pinned outlines come first")
+	setPathList(pinnedCfgKey, []string{filepath.Join(dir, "c.gv")})
+	cfg[sortOrderCfgKey] = string(byTitle)
+	sortOutlines(outlines, dir)
+	if names(outlines) != "[c a b]" {
+		t.Errorf("Fail: wanted pinned c first got %s\n", names(outlines))
+	}
+
+	fmt.Println("Recent outlines are most recent first, without repeats")
+	for i := 0; i < maxRecent+5; i++ {
+		addRecent(filepath.Join(dir, fmt.Sprintf("%d.gv", i%(maxRecent+2))))
+	}
+	addRecent(filepath.Join(dir, "3.gv"))
+	recent := pathList(recentCfgKey)
+	if len(recent) != maxRecent || recent[0] != filepath.Join(dir, "3.gv") || recent[1] != filepath.Join(dir, "2.gv") {
+		t.Errorf("Fail: wanted %d recent outlines starting with 3.gv, 2.gv got %v\n", maxRecent, recent)
+	}
+
+	fmt.Println("Paths in lists can hold the path list separator")
+	odd := filepath.Join(dir, "a:b;c.gv")
+	setPathList(pinnedCfgKey, []string{odd, filepath.Join(dir, "d.gv")})
+	if pins := pathList(pinnedCfgKey); len(pins) != 2 || pins[0] != odd || !pinnedPaths()[odd] {
+		t.Errorf("Fail: wanted %s pinned got %v\n", odd, pins)
+	}
+	cfg[pinnedCfgKey] = filepath.Join(dir, "e.gv") + string(os.PathListSeparator) + filepath.Join(dir, "f.gv")
+	if pins := pathList(pinnedCfgKey); len(pins) != 2 || pins[1] != filepath.Join(dir, "f.gv") {
+		t.Errorf("Fail: wanted pins kept by an older version read got %v\n", pins)
+	}
+
+	fmt.Println("Moving a Folder updates the pins within it")
+	setPathList(pinnedCfgKey, []string{filepath.Join(dir, "work", "x.gv"), filepath.Join(dir, "workshop.gv")})
+	renamePaths(filepath.Join(dir, "work"), filepath.Join(dir, "old", "work"))
+	if pins := fmt.Sprint(pathList(pinnedCfgKey)); pins != fmt.Sprint([]string{filepath.Join(dir, "old", "work", "x.gv"), filepath.Join(dir, "workshop.gv")}) {
+		t.Errorf("Fail: wanted x.gv moved (and workshop.gv left alone) got %s\n", pins)
+	}
+	renamePaths(filepath.Join(dir, "workshop.gv"), "")
+	if pins := pathList(pinnedCfgKey); len(pins) != 1 {
+		t.Errorf("Fail: wanted workshop.gv unpinned got %v\n", pins)
+	}
+
+	fmt.Println("The Recent Folder can't be deleted or moved")
+	base := t.TempDir()
+	storage := filepath.Join(base, "outlines")
+	os.Mkdir(storage, 0700)
+	org, err := newOrganizer(base, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPathList(pinnedCfgKey, []string{filepath.Join(storage, recentFilename, "x.gv")})
+	org.entries = []*entry{newEntry("Recent", recentFilename, true)}
+	org.deleteSelected(nil)
+	org.chooseMoveDestination(nil)
+	if pins := pathList(pinnedCfgKey); len(pins) != 1 || org.mode != folderMode {
+		t.Errorf("Fail: Recent should be left alone, got pins %v in mode %v\n", pins, org.mode)
+	}
+
+	fmt.Println("An outline is only forgotten once it has been deleted")
+	undeletable := filepath.Join(storage, "bad\x00name.gv") // no file can have this name, so removing it fails
+	deletable := filepath.Join(storage, "x.gv")
+	ioutil.WriteFile(deletable, []byte("{}"), 0644)
+	setPathList(pinnedCfgKey, []string{undeletable, deletable})
+	org.links = linkIndex{undeletable: {{undeletable, "Bad", 1, "", link{}}}, deletable: {{deletable, "X", 1, "", link{}}}}
+	if err := org.remove(undeletable, false); err == nil {
+		t.Errorf("Fail: wanted an error removing %q\n", undeletable)
+	}
+	if err := org.remove(deletable, false); err != nil {
+		t.Errorf("Fail: removing x.gv got %v\n", err)
+	}
+	if pins := pathList(pinnedCfgKey); len(pins) != 1 || pins[0] != undeletable || len(org.links) != 1 || org.links[undeletable] == nil {
+		t.Errorf("Fail: wanted only x.gv forgotten got pins %v and links %v\n", pins, org.links)
+	}
+	cfg = make(config)
+}
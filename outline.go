@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 )
 
 /*
@@ -18,16 +19,22 @@ type Outline struct {
 	Headlines     []*Headline       // list of top level headlines (this denotes the structure of the outline)
 	Bullets       bulletStyle       // how should bullets be represented?
 	MultiList     bool              // Is Outline a single or multiple Lists?
+	Version       int               // version of the .gv file format this outline was saved with
+	NextID        int               // ID to give the next new Headline (IDs are never reused within an outline)
 	headlineIndex map[int]*Headline // index to all Headlines (keyed by ID- this makes serialization easier than using pointers)
 }
 
 // Headline is an entry in the headlineIndex map
-// Headline ID is set by its key in the headlineIndex
+// Headline ID is set by its key in the headlineIndex.  The ID is only unique within its outline, the UID is
+//  unique across all outlines and stays with the Headline when it is moved (links refer to Headlines by UID)
 type Headline struct {
 	ID       int
+	UID      string
 	ParentID int
-	Expanded bool       // should Headline's children be rendered?
-	Buf      PieceTable // buffer holding the text of the headline
+	Expanded bool        // should Headline's children be rendered?
+	Buf      PieceTable  // buffer holding the text of the headline
+	Note     *PieceTable `json:",omitempty"` // optional multi-line note attached to the headline (nil if none)
+	ShowNote bool        `json:",omitempty"` // should the note be rendered beneath the headline?
 	Children []*Headline
 }
 
@@ -43,13 +50,16 @@ const (
 
 const nodeDelim = '\ufeff'
 
+// Version 1 added the Headline UID and Outline NextID fields
+const outlineVersion = 1
+
 const emptyHeadlineText = string(nodeDelim) // every Headline's text ends with a nonprinting rune so we can append to it easily
 
 var dbg int
 var dbg2 int
 
 func newOutline(title string) *Outline {
-	o := &Outline{title, []*Headline{}, glyphBullet, true, make(map[int]*Headline)}
+	o := &Outline{title, []*Headline{}, glyphBullet, true, outlineVersion, 1, make(map[int]*Headline)}
 	return o
 }
 
@@ -67,8 +77,11 @@ func (h *Headline) toString(level int) string {
 		buf += "   "
 	}
 	text := h.Buf.Text()
-	buf += fmt.Sprintf("ID: %d;Parent ID %d;", h.ID, h.ParentID)
+	buf += fmt.Sprintf("ID: %d;UID %s;Parent ID %d;", h.ID, h.UID, h.ParentID)
 	buf += text
+	if h.Note != nil {
+		buf += fmt.Sprintf("[Note: %s]", h.Note.Text())
+	}
 	buf += fmt.Sprintf("(%d chars, %d children)", len(text), len(h.Children))
 	for _, child := range h.Children {
 		buf += child.toString(level + 1)
@@ -77,15 +90,14 @@ func (h *Headline) toString(level int) string {
 }
 
 func (o *Outline) dump(e *editor) {
-	text := (*o.headlineIndex[e.currentHeadlineID].Buf.Runes())
 	out := "Headline and children\n"
 	//i, c := o.childrenSliceFor(13)
 	//for _, h := range o.Headlines {
 	//	out += h.toString(0) + "\n"
 	//}
 	out += fmt.Sprintf("\nscreen width %d, org width %d, editor width %d\n", screenWidth, e.org.width, e.editorWidth)
-	out += fmt.Sprintf("\nlinePtr %d, currentHeadline %d, currentPosition %d, current Rune (%#U) num Headlines %d, dbg %d, dbg2 %d\n",
-		e.linePtr, e.currentHeadlineID, e.currentPosition, text[e.currentPosition], len(o.headlineIndex), dbg, dbg2)
+	out += fmt.Sprintf("\nlinePtr %d, currentHeadline %d, currentPosition %d, inNote %v, current Rune (%#U) num Headlines %d, dbg %d, dbg2 %d\n",
+		e.linePtr, e.currentHeadlineID, e.currentPosition, e.inNote, e.currentBuf().RuneAt(e.currentPosition), len(o.headlineIndex), dbg, dbg2)
 	if e.selectionClipboard != nil {
 		out += fmt.Sprintf("\nSelection Clipboard >%s<\n", string(*e.selectionClipboard))
 	}
@@ -101,8 +113,36 @@ func (o *Outline) addHeadlineToIndex(h *Headline) {
 }
 
 func (o *Outline) newHeadline(text string, parent int) *Headline {
-	id := nextHeadlineID(o.headlineIndex)
-	return &Headline{id, parent, true, *NewPieceTable(text + emptyHeadlineText), []*Headline{}} // Note we're adding extra non-printing char to end of text
+	id := o.nextHeadlineID()
+	return &Headline{id, newUID(), parent, true, *NewPieceTable(text + emptyHeadlineText), nil, false, []*Headline{}} // Note we're adding extra non-printing char to end of text
+}
+
+// Give a Headline an empty Note (if it doesn't have one already) and make it visible
+func (h *Headline) addNote() {
+	if h.Note == nil {
+		h.Note = NewPieceTable(emptyHeadlineText) // Notes end with a nodeDelim just like Headline text
+	}
+	h.ShowNote = true
+}
+
+// Is this Headline's Note present but empty?
+func (h *Headline) noteIsEmpty() bool {
+	return h.Note != nil && h.Note.lastpos <= 1
+}
+
+// Move the Note from one Headline onto another, appending to any Note it already has
+func (h *Headline) takeNoteFrom(other *Headline) {
+	if other.Note == nil || other.noteIsEmpty() {
+		return
+	}
+	if h.Note == nil || h.noteIsEmpty() {
+		h.Note = other.Note
+	} else {
+		h.Note.Insert(h.Note.lastpos-1, "\n"+strings.TrimSuffix(other.Note.Text(), emptyHeadlineText))
+	}
+	h.ShowNote = h.ShowNote || other.ShowNote
+	other.Note = nil
+	other.ShowNote = false
 }
 
 // appends a new headline onto the outline under the parent
@@ -121,15 +161,96 @@ func (o *Outline) addHeadline(text string, parent int) (int, error) {
 	return h.ID, nil
 }
 
-// utility to get the next Headline id based on maximum key value in headlineIndex
-func nextHeadlineID(headlines map[int]*Headline) int {
-	var maxNumber int
-	for n := range headlines {
-		if n > maxNumber {
-			maxNumber = n
+// hand out the next Headline ID.  IDs are never reused, even after a Headline is deleted
+func (o *Outline) nextHeadlineID() int {
+	id := o.NextID
+	o.NextID++
+	return id
+}
+
+// Bring an outline loaded from an older version of the .gv format up to date.  Returns true if anything changed
+//  (and so the outline should be saved).
+func (o *Outline) migrate() bool {
+	changed := false
+	maxID := 0
+	for id := range o.headlineIndex {
+		if id > maxID {
+			maxID = id
+		}
+	}
+	if o.NextID <= maxID { // Older files didn't record NextID
+		o.NextID = maxID + 1
+		changed = true
+	}
+	o.walk(func(h *Headline, level int) {
+		if h.UID == "" { // Older files didn't have UIDs
+			h.UID = newUID()
+			changed = true
+		}
+	})
+	if o.Version < outlineVersion {
+		o.Version = outlineVersion
+		changed = true
+	}
+	return changed
+}
+
+// Make a deep copy of a Headline (and all of its children) suitable for adding to outline o.  The copies are
+//  given new IDs from o.  They keep the UIDs of the originals if keepUIDs is set (i.e. the Headlines are being
+//  moved rather than copied), otherwise they get new UIDs.
+func (o *Outline) cloneHeadline(h *Headline, parent int, keepUIDs bool) *Headline {
+	c := &Headline{o.nextHeadlineID(), newUID(), parent, h.Expanded, *NewPieceTable(h.Buf.Text()), nil, h.ShowNote, []*Headline{}}
+	if keepUIDs {
+		c.UID = h.UID
+	}
+	if h.Note != nil {
+		c.Note = NewPieceTable(h.Note.Text())
+	}
+	for _, child := range h.Children {
+		c.Children = append(c.Children, o.cloneHeadline(child, c.ID, keepUIDs))
+	}
+	return c
+}
+
+// Make a deep copy of a Headline (and all of its children) just as it is now, IDs and all.  It doesn't belong to
+//  any outline; cloneHeadline gives it new IDs when it is added to one.
+func (h *Headline) snapshot() *Headline {
+	c := &Headline{h.ID, h.UID, h.ParentID, h.Expanded, *NewPieceTable(h.Buf.Text()), nil, h.ShowNote, []*Headline{}}
+	if h.Note != nil {
+		c.Note = NewPieceTable(h.Note.Text())
+	}
+	for _, child := range h.Children {
+		c.Children = append(c.Children, child.snapshot())
+	}
+	return c
+}
+
+// Is h a descendant of ancestor?
+func (o *Outline) isDescendant(h *Headline, ancestor *Headline) bool {
+	for p := h.ParentID; p != -1; p = o.headlineIndex[p].ParentID {
+		if p == ancestor.ID {
+			return true
 		}
 	}
-	return maxNumber + 1
+	return false
+}
+
+// Find a Headline that is part of the outline by its UID
+func (o *Outline) findHeadlineByUID(UID string) *Headline {
+	return findByUID(o.Headlines, UID)
+}
+
+// Find the Headline with UID among headlines and their descendants, stopping at the first one found
+func findByUID(headlines []*Headline, UID string) *Headline {
+	for _, h := range headlines {
+		if h.UID == UID {
+			return h
+		}
+		if found := findByUID(h.Children, UID); found != nil {
+			return found
+		}
+	}
+	return nil
 }
 
 // Return the IDs of the Headlines just before and after the Headline at given ID.  Return -1 for either if at beginning or end of outline.
@@ -138,24 +259,13 @@ func nextHeadlineID(headlines map[int]*Headline) int {
 func (o *Outline) prevNextFrom(ID int, e *editor) (int, int) {
 	previous := -1
 	next := -1
-	// generate list of ordered, unique headline IDs from e.lineIndex
-	var headlines []int
-	for _, l := range e.lineIndex {
-		if len(headlines) == 0 || headlines[len(headlines)-1] != l.headlineID {
-			headlines = append(headlines, l.headlineID)
+	// find the Headline in the visible order of Headlines from the last layout
+	if c, found := e.visibleIndex[ID]; found {
+		if c < len(e.visibleOrder)-1 {
+			next = e.visibleOrder[c+1]
 		}
-	}
-
-	// now find previous and next
-	for c, i := range headlines {
-		if i == ID {
-			if c < len(headlines)-1 {
-				next = headlines[c+1]
-			}
-			if c > 0 {
-				previous = headlines[c-1]
-			}
-			break
+		if c > 0 {
+			previous = e.visibleOrder[c-1]
 		}
 	}
 
@@ -213,6 +323,60 @@ func (o *Outline) currentHeadline(e *editor) *Headline {
 	return o.headlineIndex[e.currentHeadlineID]
 }
 
+// Walk every Headline in the outline depth-first, calling fn with the Headline and its level (top level is 1)
+func (o *Outline) walk(fn func(h *Headline, level int)) {
+	for _, h := range o.Headlines {
+		h.walk(1, fn)
+	}
+}
+
+func (h *Headline) walk(level int, fn func(h *Headline, level int)) {
+	fn(h, level)
+	for _, c := range h.Children {
+		c.walk(level+1, fn)
+	}
+}
+
+// Compact the text of every Headline and Note so we save (and keep editing) the smallest form of each
+func (o *Outline) compact() {
+	o.walk(func(h *Headline, level int) {
+		h.Buf.Compact()
+		if h.Note != nil {
+			h.Note.Compact()
+		}
+	})
+}
+
+// Expand or collapse every Headline in the outline
+func (o *Outline) setExpandedAll(expanded bool) {
+	o.walk(func(h *Headline, level int) { h.Expanded = expanded })
+}
+
+// Expand or collapse this Headline and all of its descendants
+func (h *Headline) setExpandedRecursive(expanded bool) {
+	h.walk(1, func(c *Headline, level int) { c.Expanded = expanded })
+}
+
+// Fold the outline so only Headlines at levels 1..n are visible
+func (o *Outline) showToLevel(n int) {
+	o.walk(func(h *Headline, level int) { h.Expanded = level < n })
+}
+
+// Return the outermost collapsed ancestor of the Headline with ID (i.e. the Headline the user actually
+//  sees in its place).  Returns the Headline itself if all of its ancestors are expanded.
+func (o *Outline) visibleAncestor(ID int) *Headline {
+	h := o.headlineIndex[ID]
+	visible := h
+	for p := h.ParentID; p != -1; {
+		parent := o.headlineIndex[p]
+		if !parent.Expanded {
+			visible = parent
+		}
+		p = parent.ParentID
+	}
+	return visible
+}
+
 // Insert a Headline into a children slice at the given index
 //  Updates the provided slice of Headlines
 // 0 <= index <= len(children)
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// Build a small outline for testing:
+//  One
+//    A
+//      i
+//    B
+//  Two
+func testOutline() *Outline {
+	o := newOutline("Test")
+	one, _ := o.addHeadline("One", -1)
+	a, _ := o.addHeadline("A", one)
+	o.addHeadline("i", a)
+	o.addHeadline("B", one)
+	o.addHeadline("Two", -1)
+	return o
+}
+
+func TestFolding(t *testing.T) {
+
+	fmt.Println("Show only first level")
+	o := testOutline()
+	o.showToLevel(1)
+	o.walk(func(h *Headline, level int) {
+		if h.Expanded {
+			t.Errorf("Fail: level %d Headline %d should be collapsed\n", level, h.ID)
+		}
+	})
+
+	fmt.Println("Show two levels")
+	o.showToLevel(2)
+	o.walk(func(h *Headline, level int) {
+		if h.Expanded != (level < 2) {
+			t.Errorf("Fail: level %d Headline %d expanded is %v\n", level, h.ID, h.Expanded)
+		}
+	})
+
+	fmt.Println("Visible ancestor of hidden Headline")
+	o.setExpandedAll(true)
+	o.headlineIndex[1].Expanded = false
+	if v := o.visibleAncestor(3); v.ID != 1 {
+		t.Errorf("Fail: visible ancestor of 3 wanted 1 got %d\n", v.ID)
+	}
+	if v := o.visibleAncestor(5); v.ID != 5 {
+		t.Errorf("Fail: visible ancestor of 5 wanted 5 got %d\n", v.ID)
+	}
+
+	fmt.Println("Expand subtree recursively")
+	o.setExpandedAll(false)
+	o.headlineIndex[1].setExpandedRecursive(true)
+	for _, id := range []int{1, 2, 3, 4} {
+		if !o.headlineIndex[id].Expanded {
+			t.Errorf("Fail: Headline %d should be expanded\n", id)
+		}
+	}
+	if o.headlineIndex[5].Expanded {
+		t.Errorf("Fail: Headline 5 should still be collapsed\n")
+	}
+}
+
+func TestNotes(t *testing.T) {
+
+	fmt.Println("Save and load a multi-line Note")
+	o := testOutline()
+	h := o.headlineIndex[2]
+	h.addNote()
+	h.Note.Insert(0, "first line\nsecond \"line\"")
+	buf, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("Fail: unable to marshal outline with Note: %v\n", err)
+	}
+	var loaded Outline
+	if err := json.Unmarshal(buf, &loaded); err != nil {
+		t.Fatalf("Fail: unable to unmarshal outline with Note: %v\n", err)
+	}
+	note := loaded.Headlines[0].Children[0].Note
+	if note == nil || note.Text() != h.Note.Text() {
+		t.Errorf("Fail: Note wanted >%s< got >%v<\n", h.Note.Text(), note)
+	}
+	if loaded.Headlines[1].Note != nil {
+		t.Errorf("Fail: Headline without a Note should not have one after loading\n")
+	}
+
+	fmt.Println("Join Headlines with Notes")
+	other := o.headlineIndex[4]
+	other.addNote()
+	other.Note.Insert(0, "third line")
+	h.takeNoteFrom(other)
+	answer := "first line\nsecond \"line\"\nthird line" + emptyHeadlineText
+	if h.Note.Text() != answer {
+		t.Errorf("Fail: joined Note wanted >%s< got >%s<\n", answer, h.Note.Text())
+	}
+	if other.Note != nil {
+		t.Errorf("Fail: Note should have been taken from Headline 4\n")
+	}
+}
+
+func TestHeadlineIDs(t *testing.T) {
+
+	fmt.Println("IDs are not reused after a delete")
+	o := testOutline()
+	_, children := o.childrenSliceFor(5)
+	o.removeChildFrom(children, 5)
+	if id, _ := o.addHeadline("Three", -1); id != 6 {
+		t.Errorf("Fail: new Headline ID wanted 6 got %d\n", id)
+	}
+
+	fmt.Println("UIDs are unique")
+	seen := make(map[string]bool)
+	o.walk(func(h *Headline, level int) {
+		if h.UID == "" || seen[h.UID] {
+			t.Errorf("Fail: Headline %d has missing or duplicate UID >%s<\n", h.ID, h.UID)
+		}
+		seen[h.UID] = true
+	})
+	o.walk(func(h *Headline, level int) {
+		if found := o.findHeadlineByUID(h.UID); found != h {
+			t.Errorf("Fail: finding Headline %d by its UID got %v\n", h.ID, found)
+		}
+	})
+	if found := o.findHeadlineByUID("missing"); found != nil {
+		t.Errorf("Fail: wanted no Headline with UID missing got %d\n", found.ID)
+	}
+
+	fmt.Println("Migrate an outline from before UIDs")
+	var old Outline
+	err := json.Unmarshal([]byte(`{"Title":"Old","Headlines":[{"ID":3,"ParentID":-1,"Expanded":true,"Buf":{"text":"x"},"Children":[]}]}`), &old)
+	if err != nil {
+		t.Fatalf("Fail: unable to unmarshal old outline: %v\n", err)
+	}
+	old.headlineIndex = make(map[int]*Headline)
+	old.addHeadlineToIndex(old.Headlines[0])
+	if !old.migrate() {
+		t.Errorf("Fail: old outline should have needed migration\n")
+	}
+	if old.Headlines[0].UID == "" || old.NextID != 4 || old.Version != outlineVersion {
+		t.Errorf("Fail: migrated outline has UID >%s< NextID %d Version %d\n", old.Headlines[0].UID, old.NextID, old.Version)
+	}
+	if old.migrate() {
+		t.Errorf("Fail: migrated outline should not need migrating again\n")
+	}
+
+	fmt.Println("Copies get new UIDs, moves keep them")
+	other := newOutline("Other")
+	original := o.headlineIndex[1]
+	copied := other.cloneHeadline(original, -1, false)
+	moved := other.cloneHeadline(original, -1, true)
+	if copied.UID == original.UID || copied.Children[0].UID == original.Children[0].UID {
+		t.Errorf("Fail: copied Headline kept its UID\n")
+	}
+	if moved.UID != original.UID || moved.Children[0].Children[0].UID != original.Children[0].Children[0].UID {
+		t.Errorf("Fail: moved Headline lost its UID\n")
+	}
+	if moved.Children[0].ParentID != moved.ID || moved.Buf.Text() != original.Buf.Text() {
+		t.Errorf("Fail: moved Headline not cloned correctly\n")
+	}
+
+	fmt.Println("Snapshots keep their IDs and don't use up new ones")
+	nextID := o.NextID
+	snap := original.snapshot()
+	if o.NextID != nextID || snap.ID != original.ID || snap.UID != original.UID || snap.Children[0].ID != original.Children[0].ID {
+		t.Errorf("Fail: snapshot changed IDs (NextID %d to %d)\n", nextID, o.NextID)
+	}
+	original.Buf.Insert(0, "changed ")
+	if snap.Buf.Text() == original.Buf.Text() {
+		t.Errorf("Fail: snapshot shares its text with the original\n")
+	}
+}
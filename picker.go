@@ -0,0 +1,252 @@
+package main
+
+import (
+	"sort"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+The picker is an overlay for choosing one of a (possibly long) list of items by typing a few of the characters in
+it.  Typed characters have to appear in an item in the same order, but not next to each other, so "wkpl" finds
+"Work / Plans".  Matches are ranked as we type- characters next to each other, at the start of a word or at the
+start of the item count for more.
+
+UP/DOWN move through the matches, ENTER picks one and ESC gives up.
+
+*/
+
+// something that can be picked
+type pickerItem struct {
+	label  string // what is shown (and matched against)
+	detail string // more about the item, shown dimmed after the label (and also matched against)
+}
+
+// an item that matches what has been typed so far
+type pickerMatch struct {
+	index     int   // which item
+	score     int   // how well it matched (higher is better)
+	positions []int // where in the item's text the typed characters were found
+}
+
+// The text of an item that typed characters are matched against
+func (item pickerItem) text() []rune {
+	if item.detail == "" {
+		return []rune(item.label)
+	}
+	return []rune(item.label + "  " + item.detail)
+}
+
+// How well pattern matches text (and where), or false if it doesn't
+func fuzzyMatch(pattern []rune, text []rune) (int, []int, bool) {
+	if len(pattern) == 0 {
+		return 0, nil, true
+	}
+	if positions := matchPositions(pattern, text, true); positions != nil {
+		return matchScore(text, positions), positions, true
+	}
+	// Jumping ahead to the start of a word can use up the text too soon- try without
+	if positions := matchPositions(pattern, text, false); positions != nil {
+		return matchScore(text, positions), positions, true
+	}
+	return 0, nil, false
+}
+
+// Where each character of pattern is found in text (nil if they aren't all there, in order).  Each is matched to
+//  the first place it can go, unless (when preferWords) a better place- the start of a word, or right after the
+//  previous character- is coming up.
+func matchPositions(pattern []rune, text []rune, preferWords bool) []int {
+	var positions []int
+	t := 0
+	for _, p := range pattern {
+		p = unicode.ToLower(p)
+		found := -1
+		for i := t; i < len(text); i++ {
+			if unicode.ToLower(text[i]) != p {
+				continue
+			}
+			if found == -1 {
+				found = i
+			}
+			if !preferWords || (len(positions) > 0 && positions[len(positions)-1] == i-1) {
+				break
+			}
+			if startsWord(text, i) {
+				found = i
+				break
+			}
+		}
+		if found == -1 {
+			return nil
+		}
+		positions = append(positions, found)
+		t = found + 1
+	}
+	return positions
+}
+
+// Matches at the start of text, the start of words and next to each other count for more.  Matches far apart count
+//  for less.
+func matchScore(text []rune, positions []int) int {
+	score := 0
+	for i, p := range positions {
+		switch {
+		case p == 0:
+			score += 12
+		case startsWord(text, p):
+			score += 8
+		case i > 0 && positions[i-1] == p-1:
+			score += 6
+		default:
+			score++
+		}
+		if i > 0 {
+			score -= (p - positions[i-1] - 1) / 4
+		}
+	}
+	return score
+}
+
+func startsWord(text []rune, i int) bool {
+	return i == 0 || (!unicode.IsLetter(text[i-1]) && !unicode.IsDigit(text[i-1])) ||
+		(unicode.IsUpper(text[i]) && unicode.IsLower(text[i-1]))
+}
+
+// The items matching pattern, best first.  Items that match equally well are shortest first, otherwise they stay
+//  in their original order (which is all of them, until something is typed).
+func rankItems(items []pickerItem, pattern string) []pickerMatch {
+	var matches []pickerMatch
+	p := []rune(pattern)
+	for i, item := range items {
+		if score, positions, ok := fuzzyMatch(p, item.text()); ok {
+			matches = append(matches, pickerMatch{i, score, positions})
+		}
+	}
+	if len(p) == 0 {
+		return matches
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return len(items[matches[i].index].label) < len(items[matches[j].index].label)
+	})
+	return matches
+}
+
+// Let the user pick one of items.  Returns the index of the item picked (-1 if nothing matched), what had been
+//  typed when ENTER was pressed (so callers can make sense of typing that isn't meant to match an item) and
+//  false if the user gave up with ESC.
+func pick(s tcell.Screen, title string, items []pickerItem) (int, string, bool) {
+	var query []rune
+	matches := rankItems(items, "")
+	current := 0 // which match is selected
+	top := 0     // which match is at the top of the list
+	for {
+		height := drawPicker(s, title, items, string(query), matches, current, top)
+		switch ev := s.PollEvent().(type) {
+		case *tcell.EventResize:
+			s.Sync()
+			screenWidth, screenHeight = s.Size()
+			drawScreen(s)
+		case *tcell.EventKey:
+			switch ev.Key() {
+			case tcell.KeyRune:
+				query = append(query, ev.Rune())
+				matches = rankItems(items, string(query))
+				current, top = 0, 0
+			case tcell.KeyBackspace, tcell.KeyBackspace2:
+				if len(query) > 0 {
+					query = query[:len(query)-1]
+					matches = rankItems(items, string(query))
+					current, top = 0, 0
+				}
+			case tcell.KeyDown, tcell.KeyCtrlN:
+				if current < len(matches)-1 {
+					current++
+				}
+			case tcell.KeyUp, tcell.KeyCtrlP:
+				if current > 0 {
+					current--
+				}
+			case tcell.KeyEnter:
+				if len(matches) == 0 {
+					return -1, string(query), true
+				}
+				return matches[current].index, string(query), true
+			case tcell.KeyEscape:
+				return -1, string(query), false
+			}
+			if current < top { // Scroll?
+				top = current
+			} else if current >= top+height {
+				top = current - height + 1
+			}
+		}
+	}
+}
+
+// Draw the picker over the middle of the screen.  Returns how many matches fit.
+func drawPicker(s tcell.Screen, title string, items []pickerItem, query string, matches []pickerMatch, current int, top int) int {
+	width := screenWidth * 3 / 5
+	if width < 30 {
+		width = screenWidth
+	}
+	height := screenHeight * 3 / 5
+	if height < 6 {
+		height = screenHeight
+	}
+	x := (screenWidth - width) / 2
+	y := (screenHeight - height) / 2
+	drawFrame(s, x, y, width, height, title)
+	// What has been typed so far
+	used := drawText(s, x+2, y+1, "> "+query, width-4, defStyle)
+	s.ShowCursor(x+2+used, y+1)
+	rows := height - 3
+	for row := 0; row < rows && top+row < len(matches); row++ {
+		m := matches[top+row]
+		item := items[m.index]
+		style, matchStyle, detailStyle := defStyle, defStyle.Bold(true).Underline(true), noteStyle
+		if top+row == current {
+			style, matchStyle, detailStyle = selectedStyle, selectedStyle.Bold(true).Underline(true), selectedStyle
+			for cx := x + 1; cx < x+width-1; cx++ {
+				s.SetContent(cx, y+2+row, ' ', nil, selectedStyle)
+			}
+		}
+		drawMatch(s, x+2, y+2+row, item, m.positions, width-4, style, matchStyle, detailStyle)
+	}
+	s.Show()
+	return rows
+}
+
+// Draw an item with the characters that matched picked out
+func drawMatch(s tcell.Screen, x int, y int, item pickerItem, positions []int, width int, style, matchStyle, detailStyle tcell.Style) {
+	matched := make(map[int]bool)
+	for _, p := range positions {
+		matched[p] = true
+	}
+	label := len([]rune(item.label))
+	used := 0
+	r := 0 // index of the cluster's first rune
+	for _, c := range clustersOf(item.text()) {
+		w := clusterWidth(c)
+		if used+w > width {
+			s.SetContent(x+width-1, y, ellipsis, nil, style)
+			return
+		}
+		cs := style
+		if r >= label {
+			cs = detailStyle
+		}
+		for i := range c {
+			if matched[r+i] {
+				cs = matchStyle
+			}
+		}
+		s.SetContent(x+used, y, c[0], c[1:], cs)
+		used += w
+		r += len(c)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestPicker(t *testing.T) {
+
+	fmt.Println("Fuzzy match characters in order")
+	for _, test := range []struct {
+		pattern   string
+		text      string
+		positions string
+	}{
+		{"wkpl", "Work / Plans", "[0 3 7 8]"},
+		{"plans", "Work / Plans", "[7 8 9 10 11]"},
+		{"ab", "xa Ay", "[]"},         // no b at all
+		{"ay", "xa Ay", "[3 4]"},      // prefer the start of a word
+		{"ab", "xxa Abc ab", "[4 5]"}, // ...but only if the rest still matches
+		{"ac", "xa Ab c", "[3 6]"},
+		{"ca", "xa Ab c", "[]"},
+	} {
+		_, positions, ok := fuzzyMatch([]rune(test.pattern), []rune(test.text))
+		if fmt.Sprint(positions) != test.positions || ok != (test.positions != "[]") {
+			t.Errorf("Fail: matching %s in %s wanted %s got %v (%v)\n", test.pattern, test.text, test.positions, positions, ok)
+		}
+	}
+
+	fmt.Println("Rank matches as we type")
+	items := []pickerItem{{"Shopping list", "outlines"}, {"Plans", "outlines / Work"}, {"Planning", "outlines"}, {"Old plans", "outlines"}}
+	if matches := rankItems(items, ""); len(matches) != 4 || matches[0].index != 0 {
+		t.Errorf("Fail: wanted everything (in order) before typing got %v\n", matches)
+	}
+	matches := rankItems(items, "plan")
+	var ranked []string
+	for _, m := range matches {
+		ranked = append(ranked, items[m.index].label)
+	}
+	if fmt.Sprint(ranked) != "[Plans Planning Old plans]" {
+		t.Errorf("Fail: wanted [Plans Planning Old plans] got %v\n", ranked)
+	}
+	if matches := rankItems(items, "work"); len(matches) != 1 || matches[0].index != 1 {
+		t.Errorf("Fail: wanted the Folder path matched got %v\n", matches)
+	}
+
+	fmt.Println("Pick by typing")
+	s := tcell.NewSimulationScreen("")
+	s.Init()
+	s.SetSize(80, 24)
+	screenWidth, screenHeight = s.Size()
+	for _, r := range "plan" {
+		s.InjectKey(tcell.KeyRune, r, tcell.ModNone)
+	}
+	s.InjectKey(tcell.KeyDown, 0, tcell.ModNone)
+	s.InjectKey(tcell.KeyEnter, 0, tcell.ModNone)
+	if i, query, ok := pick(s, "Open", items); i != 2 || query != "plan" || !ok {
+		t.Errorf("Fail: wanted Planning (2) picked with plan got %d with %s\n", i, query)
+	}
+	s.InjectKey(tcell.KeyRune, 'z', tcell.ModNone)
+	s.InjectKey(tcell.KeyEnter, 0, tcell.ModNone)
+	if i, _, ok := pick(s, "Open", items); i != -1 || !ok {
+		t.Errorf("Fail: nothing matches z, but got %d\n", i)
+	}
+	s.InjectKey(tcell.KeyRune, 'p', tcell.ModNone)
+	s.InjectKey(tcell.KeyEscape, 0, tcell.ModNone)
+	if i, _, ok := pick(s, "Open", items); i != -1 || ok {
+		t.Errorf("Fail: ESC should give up, but got %d\n", i)
+	}
+	s.Fini()
+}
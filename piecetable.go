@@ -1,27 +1,91 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"sort"
+	"sync/atomic"
+	"unicode"
 )
 
 /*
 	Piece Table implementation for the text editor- allows for efficient insert/delete activity on a sequence of runes
+
+	The pieces are kept in a balanced binary tree (a treap ordered by text position and balanced by random node
+	priorities).  Every node caches the total length of the text in its subtree, so finding a position, inserting
+	and deleting are all O(log n) in the number of pieces.  Edits never modify a node that is already in the tree-
+	they build new nodes along the path they change and share everything else.
+
+	Because old trees are never modified, undo is cheap: before each edit we remember the root of the tree.  The
+	remembered trees share every node the edit didn't touch, so each undo step only costs the handful of nodes the
+	edit created, and neither the add nor the original buffer is ever copied.
+
+	Long editing sessions leave the text scattered across many pieces and the add buffer full of runes that have
+	since been deleted.  Compact rewrites the text into a fresh original buffer held by a single piece.  The runes
+	the undo history still needs are copied out into a buffer of their own at the same time, so the old buffers
+	(and the deleted text in them that can no longer be undone back to) can be freed.
 */
 
+const (
+	maxUndo         = 1000 // most edits we remember for each PieceTable
+	maxTypedRunes   = 40   // most typed runes that are undone together
+	compactPieces   = 1000 // compact once the text is split into this many pieces...
+	compactMinAdd   = 4096 // ...or the add buffer is at least this long...
+	compactAddRatio = 4    // ...and this many times longer than the text itself
+)
+
 type piece struct {
-	source *[]rune // should point to original or add slices in piecetable
+	source []rune // should be the original or add buffer in piecetable
 	start  int
-	length int // Sum of all piece lengths == length of final edited text
+	length int  // Sum of all piece lengths == length of final edited text
+	add    bool // is source the add buffer?
+}
+
+// a node in the tree of pieces
+type node struct {
+	piece    piece
+	priority uint32 // nodes have a higher priority than their children
+	size     int    // total length of the pieces in this subtree
+	count    int    // number of pieces in this subtree
+	left     *node
+	right    *node
 }
 
 // PieceTable manages efficient edits to a string of text
 type PieceTable struct {
 	original []rune
 	add      []rune
-	pieces   []piece
+	root     *node // tree of pieces (nil when there is no text)
 	lastpos  int
+	seed     uint32  // state of the random number generator for node priorities
+	history  history // undo/redo state
+	version  uint64  // changes whenever the text does
+}
+
+var lastVersion uint64 // every PieceTable (and every change to one) gets a version no other PieceTable has had
+
+func nextVersion() uint64 {
+	return atomic.AddUint64(&lastVersion, 1)
+}
+
+// an earlier (or later) version of the text
+type revision struct {
+	root     *node
+	length   int
+	position int // where the edit that moved us away from this revision happened
+}
+
+// undo and redo stacks for a PieceTable
+type history struct {
+	undo       []revision
+	redo       []revision
+	groupDepth int  // how many BeginGroup calls are waiting for an EndGroup
+	groupSaved bool // has the current group saved its revision yet?
+	typing     bool // was the last edit a single typed rune?
+	typedEnd   int  // position just after the last typed rune
+	typedRunes int  // how many runes have been typed since the last revision was saved
+	typedSpace bool // was the last typed rune whitespace?
 }
 
 // NewPieceTable creates a piecetable instance
@@ -31,23 +95,31 @@ func NewPieceTable(orig string) *PieceTable {
 	pt := PieceTable{
 		origrunes,
 		[]rune{},
-		[]piece{},
+		nil,
 		length,
+		0,
+		history{},
+		nextVersion(),
+	}
+	if length > 0 {
+		pt.root = pt.newNode(piece{pt.original, 0, length, false}, nil, nil)
 	}
-	p := piece{&(pt.original), 0, len(pt.original)}
-	pt.pieces = append(pt.pieces, p)
 	return &pt
 }
 
 // Dump generates a debug view of the PieceTable for troubleshooting
 func (p *PieceTable) Dump() {
-	fmt.Printf("Original buffer:\n\t(%p), %s\n", &p.original, string(p.original))
-	fmt.Printf("Add buffer:\n\t(%p) %s\nPieces:", &p.add, string(p.add))
+	fmt.Printf("Original buffer:\n\t%s\n", string(p.original))
+	fmt.Printf("Add buffer:\n\t%s\n", string(p.add))
 	fmt.Printf("Lastpos: %d\n", p.lastpos)
 	fmt.Printf("Pieces:\n\tSource\t\t\tStart\tLength\n\t------\t\t\t-----\t------\n")
-	for _, piece := range p.pieces {
-		fmt.Printf("\t%p\t\t\t%d\t%d\n", piece.source, piece.start, piece.length)
-	}
+	p.root.walk(func(pc piece) {
+		source := "original"
+		if pc.add {
+			source = "add"
+		}
+		fmt.Printf("\t%s\t\t%d\t%d\n", source, pc.start, pc.length)
+	})
 	fmt.Println()
 }
 
@@ -59,41 +131,33 @@ func (p *PieceTable) Insert(position int, fragment string) {
 
 // InsertRunes puts a slice of runes into the string at given position
 func (p *PieceTable) InsertRunes(position int, runes []rune) {
+	if len(runes) == 0 {
+		return
+	}
 	// save in the add buffer and create the necessary piece instance
 	start := len(p.add)
 	length := len(runes)
+	left, right := split(p.root, position)
+	last := left.last()
+	// Are we typing onto the end of the last thing we inserted?  (check before appending, which may move the add buffer)
+	extend := last != nil && last.piece.add && last.piece.start+last.piece.length == start && sameBuffer(last.piece.source, p.add)
 	p.add = append(p.add, runes...)
-	newadd := piece{&(p.add), start, length}
-
-	//fmt.Printf("Inserting at position %d\n", position)
+	var typed rune
+	if length == 1 {
+		typed = runes[0]
+	}
+	p.saveRevision(position, typed)
 
-	if position == 0 {
-		// insert newadd to front of pieces list
-		p.pieces = append([]piece{newadd}, p.pieces...)
-	} else if position == p.lastpos {
-		// append newadd to end of pieces list
-		p.pieces = append(p.pieces, newadd)
+	if extend { // just make the last piece longer
+		left = left.extendLast(p.add, length)
 	} else {
-		// We have to look for the right piece now to split so we can insert mid-string
-		totalLength := 0
-		i := 0
-		for i < len(p.pieces) {
-			totalLength += p.pieces[i].length
-			if totalLength >= position {
-				break
-			}
-			i++
-		}
-		// We're on the piece that needs to be split
-		newRemainder := (totalLength - position)      // What is length of the remainder after we split this piece?
-		p.pieces[i].length -= newRemainder            // "shrink" this piece where we split it
-		p.pieces = insertPiece(p.pieces, newadd, i+1) // Insert a piece for the thing we're inserting after split
-		p.pieces = insertPiece(p.pieces,
-			piece{p.pieces[i].source, p.pieces[i].start + p.pieces[i].length, newRemainder}, i+2) // Insert new piece (which we split from p.pieces[i]) for remainder
+		left = merge(left, p.newNode(piece{p.add, start, length, true}, nil, nil))
 	}
+	p.root = merge(left, right)
 
 	p.lastpos += length
-
+	p.version = nextVersion()
+	p.compactIfFragmented()
 }
 
 // AppendRune will add a single rune to the end of the PieceTable
@@ -108,65 +172,113 @@ func (p *PieceTable) Append(fragment string) {
 
 // Delete removes length characters starting at position
 func (p *PieceTable) Delete(position int, spanLength int) {
-	//fmt.Printf("Deleting at position %d for %d runes\n", position, spanLength)
-	// First step is to figure out which piece begins the span
-	totalLength := 0
-	i := 0
-	for i < len(p.pieces) {
-		totalLength += p.pieces[i].length
-		if totalLength > position {
-			break
-		}
-		i++
-	}
-
-	// Now process the delete depending on how many pieces the span crosses
-	newRemainder := (totalLength - position)
-	//fmt.Printf("Found span start in piece %d, TL=%d, NR=%d\n", i, totalLength, newRemainder)
-	if p.pieces[i].length >= spanLength {
-		//fmt.Printf("Delete entirely within this piece #%d\n", i)
-		if totalLength-p.pieces[i].length == position {
-			// span starts at beginning if piece, just adjust start and length
-			//fmt.Printf("Delete from beginning of text\n")
-			p.pieces[i].start += spanLength
-			p.pieces[i].length -= spanLength
-		} else if position+spanLength == totalLength {
-			// span ends at end off piece, just adjust length
-			//fmt.Printf("Delete from end of text\n")
-			p.pieces[i].length -= spanLength
-		} else {
-			// span is in middle of piece, split the piece 'around' it
-			//fmt.Printf("Delete from middle of text\n")
-			origLength := p.pieces[i].length
-			p.pieces[i].length -= totalLength - position // 'truncate' leftmost piece before span
-			rmStart := p.pieces[i].start + p.pieces[i].length + spanLength
-			rmLength := origLength - p.pieces[i].length - spanLength
-			//fmt.Printf("Rightmost start is %d, length is %d\n", rmStart, rmLength)
-			p.pieces = insertPiece(p.pieces, piece{p.pieces[i].source, rmStart, rmLength}, i+1) // rightmost section of original piece after the span
+	if spanLength <= 0 {
+		return
+	}
+	p.saveRevision(position, 0)
+	left, rest := split(p.root, position)
+	_, right := split(rest, spanLength)
+	p.root = merge(left, right)
+	p.lastpos = p.root.sizeOf()
+	p.version = nextVersion()
+	p.compactIfFragmented()
+}
+
+// Compact rewrites the current text into a fresh original buffer made of a single piece and empties the
+//  add buffer.  The text (and the undo history) is unchanged.
+func (p *PieceTable) Compact() {
+	if p.pieceCount() <= 1 && len(p.add) == 0 {
+		return // nothing to gain
+	}
+	p.original = *p.Runes()
+	p.add = []rune{}
+	p.root = nil
+	if len(p.original) > 0 {
+		p.root = p.newNode(piece{p.original, 0, len(p.original), false}, nil, nil)
+	}
+	p.history.rebase()
+}
+
+// Copy the runes used by the undo and redo revisions into a single new buffer and point their pieces at it, so
+//  nothing refers to the old buffers any more.  Nodes shared between revisions are still shared afterwards.
+func (h *history) rebase() {
+	type runeRange struct{ start, end, offset int } // offset is where the range was copied to in the new buffer
+	used := make(map[*rune][]runeRange)             // the ranges of each old buffer that the revisions use
+	buffers := make(map[*rune][]rune)
+	seen := make(map[*node]bool)
+	var visit func(n *node)
+	visit = func(n *node) {
+		if n == nil || seen[n] {
+			return
 		}
-	} else {
-		//fmt.Printf("Delete spans multiple pieces\n")
-		spanRemaining := spanLength - newRemainder
-		p.pieces[i].length -= newRemainder // Shorten the leftmost piece
-		for spanRemaining > 0 {            // 'delete' the remaining pieces if necessary
-			//fmt.Printf("Span remaining: %d\n", spanRemaining)
-			i++
-			//fmt.Printf("\tNow scanning pieces- on %d\n", i)
-			if p.pieces[i].length >= spanRemaining {
-				// Last piece for the deleted span, just adjust accordingly
-				//fmt.Printf("\tDeleting from piece %d\n", i)
-				p.pieces[i].start += spanRemaining
-				p.pieces[i].length -= spanRemaining
-				spanRemaining = 0
+		seen[n] = true
+		key := bufferKey(n.piece.source)
+		used[key] = append(used[key], runeRange{n.piece.start, n.piece.start + n.piece.length, 0})
+		buffers[key] = n.piece.source
+		visit(n.left)
+		visit(n.right)
+	}
+	for _, r := range h.undo {
+		visit(r.root)
+	}
+	for _, r := range h.redo {
+		visit(r.root)
+	}
+	// Merge the ranges that overlap (pieces split from the same insert share runes) and copy them
+	total := 0
+	for key, ranges := range used {
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+		merged := ranges[:1]
+		for _, r := range ranges[1:] {
+			if last := &merged[len(merged)-1]; r.start <= last.end {
+				if r.end > last.end {
+					last.end = r.end
+				}
 			} else {
-				spanRemaining -= p.pieces[i].length
-				// "Remove" this piece by setting length to 0
-				p.pieces[i].length = 0
-				//fmt.Printf("\tRemoving piece at %d\n", i)
+				merged = append(merged, r)
 			}
 		}
+		used[key] = merged
+		for _, r := range merged {
+			total += r.end - r.start
+		}
+	}
+	kept := make([]rune, 0, total)
+	for key, ranges := range used {
+		for i := range ranges {
+			ranges[i].offset = len(kept)
+			kept = append(kept, buffers[key][ranges[i].start:ranges[i].end]...)
+		}
+	}
+	rebased := make(map[*node]*node)
+	var rebuild func(n *node) *node
+	rebuild = func(n *node) *node {
+		if n == nil {
+			return nil
+		}
+		if r, found := rebased[n]; found {
+			return r
+		}
+		ranges := used[bufferKey(n.piece.source)]
+		i := sort.Search(len(ranges), func(i int) bool { return ranges[i].end > n.piece.start })
+		pc := piece{kept, ranges[i].offset + n.piece.start - ranges[i].start, n.piece.length, false}
+		r := newNode(pc, n.priority, rebuild(n.left), rebuild(n.right))
+		rebased[n] = r
+		return r
+	}
+	for i := range h.undo {
+		h.undo[i].root = rebuild(h.undo[i].root)
+	}
+	for i := range h.redo {
+		h.redo[i].root = rebuild(h.redo[i].root)
+	}
+}
+
+// Compact once editing has split the text into too many pieces or the add buffer is mostly deleted text
+func (p *PieceTable) compactIfFragmented() {
+	if p.pieceCount() >= compactPieces || (len(p.add) >= compactMinAdd && len(p.add) > compactAddRatio*p.lastpos) {
+		p.Compact()
 	}
-	p.lastpos -= spanLength
 }
 
 // Text returns the string being managed by the PieceTable with all edits applied
@@ -177,43 +289,503 @@ func (p *PieceTable) Text() string {
 
 // Runes returns the runes being managed by the PieceTable with all edits applied
 func (p *PieceTable) Runes() *[]rune {
-	var runes []rune
-	for _, piece := range p.pieces {
-		if piece.length != 0 {
-			span := (*piece.source)[piece.start : piece.start+piece.length]
-			runes = append(runes, span...)
+	runes := make([]rune, 0, p.lastpos)
+	p.root.walk(func(pc piece) {
+		runes = append(runes, pc.source[pc.start:pc.start+pc.length]...)
+	})
+	return &runes
+}
+
+// Remember the current text before an edit at position so it can be undone.  typed is the rune if the edit
+//  is a single typed rune (0 otherwise).  Consecutive typed runes are saved as a single revision- a word at a
+//  time (along with the whitespace after it), and no more than maxTypedRunes.  Edits within a group are saved
+//  as a single revision too.
+func (p *PieceTable) saveRevision(position int, typed rune) {
+	h := &p.history
+	h.redo = h.redo[:0]
+	coalesce := false
+	if h.groupDepth > 0 {
+		coalesce = h.groupSaved
+		h.groupSaved = true
+	} else {
+		coalesce = typed != 0 && h.typing && position == h.typedEnd && h.typedRunes < maxTypedRunes &&
+			!(h.typedSpace && !unicode.IsSpace(typed))
+	}
+	h.typing = typed != 0 && h.groupDepth == 0
+	h.typedEnd = position + 1
+	h.typedSpace = unicode.IsSpace(typed)
+	if coalesce {
+		h.typedRunes++
+		return
+	}
+	h.typedRunes = 1
+	h.undo = append(h.undo, revision{p.root, p.lastpos, position})
+	if len(h.undo) > maxUndo {
+		h.undo = append(h.undo[:0], h.undo[1:]...)
+	}
+}
+
+// Undo restores the text to how it was before the most recent edit (or group of edits).  Returns the position
+//  where the undone edit happened, or false if there is nothing to undo.
+func (p *PieceTable) Undo() (int, bool) {
+	h := &p.history
+	if len(h.undo) == 0 {
+		return 0, false
+	}
+	r := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	h.redo = append(h.redo, revision{p.root, p.lastpos, r.position})
+	p.root, p.lastpos = r.root, r.length
+	p.version = nextVersion()
+	h.typing = false
+	return r.position, true
+}
+
+// Redo re-applies the most recently undone edit.  Returns the position where the edit happened, or false
+//  if there is nothing to redo.
+func (p *PieceTable) Redo() (int, bool) {
+	h := &p.history
+	if len(h.redo) == 0 {
+		return 0, false
+	}
+	r := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	h.undo = append(h.undo, revision{p.root, p.lastpos, r.position})
+	p.root, p.lastpos = r.root, r.length
+	p.version = nextVersion()
+	h.typing = false
+	return r.position, true
+}
+
+// BeginGroup starts a group of edits that will be undone (and redone) together.  Groups may be nested; the
+//  group ends with the outermost EndGroup.
+func (p *PieceTable) BeginGroup() {
+	h := &p.history
+	if h.groupDepth == 0 {
+		h.groupSaved = false
+	}
+	h.groupDepth++
+	h.typing = false
+}
+
+// EndGroup ends a group of edits started with BeginGroup
+func (p *PieceTable) EndGroup() {
+	h := &p.history
+	if h.groupDepth > 0 {
+		h.groupDepth--
+	}
+	h.typing = false
+}
+
+// ClearHistory forgets all undo and redo information (e.g. when text is moved between PieceTables and undoing
+//  only one side of the move would make no sense)
+func (p *PieceTable) ClearHistory() {
+	p.history = history{}
+}
+
+// Version identifies the current text.  If the Version hasn't changed, neither has the text- so anything
+//  derived from the text (like its layout) is still good.
+func (p *PieceTable) Version() uint64 {
+	return p.version
+}
+
+// Len returns the number of runes in the text
+func (p *PieceTable) Len() int {
+	return p.lastpos
+}
+
+// RuneAt returns the rune at position (which must be within the text)
+func (p *PieceTable) RuneAt(position int) rune {
+	n := p.root
+	for n != nil {
+		leftSize := n.left.sizeOf()
+		if position < leftSize {
+			n = n.left
+		} else if position < leftSize+n.piece.length {
+			return n.piece.source[n.piece.start+position-leftSize]
+		} else {
+			position -= leftSize + n.piece.length
+			n = n.right
+		}
+	}
+	panic(fmt.Sprintf("PieceTable.RuneAt: position %d out of range (length %d)", position, p.lastpos))
+}
+
+// Slice returns a copy of the runes from start up to (but not including) end
+func (p *PieceTable) Slice(start int, end int) []rune {
+	if start < 0 {
+		start = 0
+	}
+	if end > p.lastpos {
+		end = p.lastpos
+	}
+	if start >= end {
+		return []rune{}
+	}
+	runes := make([]rune, 0, end-start)
+	return p.root.appendRange(runes, start, end)
+}
+
+// Iterator returns a RuneIterator positioned just before the rune at position
+func (p *PieceTable) Iterator(position int) *RuneIterator {
+	it := &RuneIterator{p: p}
+	it.seek(position)
+	return it
+}
+
+// RuneIterator walks forwards or backwards through the text of a PieceTable, one rune at a time, without
+//  building the whole text.  It sits "between" runes like a cursor: Next returns the rune after it and Prev
+//  returns the rune before it.  The PieceTable must not be edited while an iterator is in use.
+type RuneIterator struct {
+	p        *PieceTable
+	stack    []*node // path from the root down to the node holding the rune after the iterator
+	offset   int     // offset of the rune after the iterator within that node's piece
+	position int     // position of the rune after the iterator
+}
+
+// Position returns the position of the rune Next would return
+func (it *RuneIterator) Position() int {
+	return it.position
+}
+
+// Next returns the rune after the iterator and moves past it.  Returns false at the end of the text.
+func (it *RuneIterator) Next() (rune, bool) {
+	if it.position >= it.p.lastpos {
+		return 0, false
+	}
+	n := it.stack[len(it.stack)-1]
+	r := n.piece.source[n.piece.start+it.offset]
+	it.position++
+	it.offset++
+	if it.offset == n.piece.length {
+		it.offset = 0
+		if !it.successor() {
+			it.stack = it.stack[:0]
+		}
+	}
+	return r, true
+}
+
+// Prev returns the rune before the iterator and moves back over it.  Returns false at the start of the text.
+func (it *RuneIterator) Prev() (rune, bool) {
+	if it.position <= 0 {
+		return 0, false
+	}
+	if it.position >= it.p.lastpos { // we've run off the end of the pieces, start over from the last rune
+		it.seek(it.p.lastpos - 1)
+	} else if it.offset > 0 {
+		it.offset--
+		it.position--
+	} else {
+		it.predecessor()
+		it.offset = it.stack[len(it.stack)-1].piece.length - 1
+		it.position--
+	}
+	n := it.stack[len(it.stack)-1]
+	return n.piece.source[n.piece.start+it.offset], true
+}
+
+// Position the iterator just before the rune at position
+func (it *RuneIterator) seek(position int) {
+	it.stack = it.stack[:0]
+	it.position = position
+	it.offset = 0
+	n := it.p.root
+	for n != nil {
+		it.stack = append(it.stack, n)
+		leftSize := n.left.sizeOf()
+		if position < leftSize {
+			n = n.left
+		} else if position < leftSize+n.piece.length {
+			it.offset = position - leftSize
+			return
+		} else {
+			position -= leftSize + n.piece.length
+			n = n.right
+		}
+	}
+	it.stack = it.stack[:0] // position is at (or beyond) the end of the text
+}
+
+// Move the stack to the node holding the next piece.  Returns false if there are no more pieces.
+func (it *RuneIterator) successor() bool {
+	n := it.stack[len(it.stack)-1]
+	if n.right != nil {
+		for n = n.right; n != nil; n = n.left {
+			it.stack = append(it.stack, n)
+		}
+		return true
+	}
+	for {
+		child := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		if len(it.stack) == 0 {
+			return false
+		}
+		if it.stack[len(it.stack)-1].left == child {
+			return true
+		}
+	}
+}
+
+// Move the stack to the node holding the previous piece.  Returns false if there are no earlier pieces.
+func (it *RuneIterator) predecessor() bool {
+	n := it.stack[len(it.stack)-1]
+	if n.left != nil {
+		for n = n.left; n != nil; n = n.right {
+			it.stack = append(it.stack, n)
+		}
+		return true
+	}
+	for {
+		child := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		if len(it.stack) == 0 {
+			return false
+		}
+		if it.stack[len(it.stack)-1].right == child {
+			return true
 		}
 	}
-	return &runes
 }
 
 // MarshalJSON is a custom marshaller so our PieceTable can be exported as a string of text
+//  The JSON is written straight from the pieces, without building the whole text first.
 func (p *PieceTable) MarshalJSON() ([]byte, error) {
-	str := p.Text()
-	str = strings.Replace(str, "\"", "\\\"", -1)
-	result := "{ \"text\": \"" + str + "\" }"
-	return []byte(result), nil
+	var b bytes.Buffer
+	b.Grow(p.lastpos + 16)
+	b.WriteString("{ \"text\": \"")
+	p.root.walk(func(pc piece) {
+		for _, r := range pc.source[pc.start : pc.start+pc.length] {
+			writeJSONRune(&b, r)
+		}
+	})
+	b.WriteString("\" }")
+	return b.Bytes(), nil
+}
+
+// Write r as it must appear within a JSON string.  Quotes, backslashes and control characters are escaped,
+//  everything else is written as UTF-8.
+func writeJSONRune(b *bytes.Buffer, r rune) {
+	switch r {
+	case '"':
+		b.WriteString("\\\"")
+	case '\\':
+		b.WriteString("\\\\")
+	case '\n':
+		b.WriteString("\\n") // Notes can hold multiple lines
+	case '\r':
+		b.WriteString("\\r")
+	case '\t':
+		b.WriteString("\\t")
+	case '\u2028', '\u2029': // valid JSON, but they end lines in javascript so escape them like encoding/json does
+		fmt.Fprintf(b, "\\u%04x", r)
+	default:
+		if r >= 0 && r < 0x20 {
+			fmt.Fprintf(b, "\\u%04x", r)
+		} else {
+			b.WriteRune(r) // invalid runes are written as utf8.RuneError
+		}
+	}
 }
 
 // UnmarshalJSON is a custom unmarshaller so a JSON string can be imported as a PieceTable
-// Assumes JSON is of form { "text": "some string to initialize our PieceTable" }
-//   (if multiple entries exist in the JSON object, it is indeterminate which will be used for PieceTable)
+// Expects JSON of the form { "text": "some string to initialize our PieceTable" } and returns an error for
+//  anything else (other entries in the object are ignored).  Like encoding/json itself, null leaves the
+//  PieceTable unchanged.
 func (p *PieceTable) UnmarshalJSON(b []byte) error {
+	if string(bytes.TrimSpace(b)) == "null" {
+		return nil
+	}
 	var v interface{}
 	if err := json.Unmarshal(b, &v); err != nil {
 		return err
 	}
-	// Initialize PieceTable with first value we get from map
-	for _, value := range v.(map[string]interface{}) {
-		p.Insert(0, value.(string)) // type coerce what we got into a string
-		break
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected text of the form {\"text\": \"...\"}, found %s", jsonKind(v))
+	}
+	value, found := object["text"]
+	if !found {
+		return fmt.Errorf("expected text of the form {\"text\": \"...\"}, found an object without \"text\"")
 	}
+	text, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("expected \"text\" to be a string, found %s", jsonKind(value))
+	}
+	*p = *NewPieceTable(text)
 	return nil
 }
 
-func insertPiece(slice []piece, newpiece piece, index int) []piece {
-	s := append(slice, piece{})  // Making space for the new element
-	copy(s[index+1:], s[index:]) // Shifting elements
-	s[index] = newpiece          // Copying/inserting the value
-	return s
+// describe the kind of a decoded JSON value for error messages
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// Do a and b share the same underlying array?  (a piece can only be extended if it points into the current add
+//  buffer- after a Compact, pieces restored by Undo point into the add buffer we threw away)
+func sameBuffer(a []rune, b []rune) bool {
+	return cap(a) > 0 && cap(b) > 0 && bufferKey(a) == bufferKey(b)
+}
+
+// identifies the array underneath a (non-empty) slice of runes
+func bufferKey(runes []rune) *rune {
+	return &runes[:cap(runes)][0]
+}
+
+// the number of pieces making up the text
+func (p *PieceTable) pieceCount() int {
+	return p.root.countOf()
+}
+
+// next pseudo-random priority for a node (xorshift- we only need priorities to be independent of the text)
+func (p *PieceTable) nextPriority() uint32 {
+	if p.seed == 0 {
+		p.seed = 2463534242
+	}
+	p.seed ^= p.seed << 13
+	p.seed ^= p.seed >> 17
+	p.seed ^= p.seed << 5
+	return p.seed
+}
+
+func (p *PieceTable) newNode(pc piece, left *node, right *node) *node {
+	return newNode(pc, p.nextPriority(), left, right)
+}
+
+func newNode(pc piece, priority uint32, left *node, right *node) *node {
+	return &node{pc, priority, left.sizeOf() + pc.length + right.sizeOf(), left.countOf() + 1 + right.countOf(), left, right}
+}
+
+// a copy of n with different children
+func (n *node) with(left *node, right *node) *node {
+	return newNode(n.piece, n.priority, left, right)
+}
+
+func (n *node) sizeOf() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *node) countOf() int {
+	if n == nil {
+		return 0
+	}
+	return n.count
+}
+
+// Visit each piece in text order
+func (n *node) walk(fn func(pc piece)) {
+	if n == nil {
+		return
+	}
+	n.left.walk(fn)
+	fn(n.piece)
+	n.right.walk(fn)
+}
+
+// Append the runes of tree n between start and end (relative to the start of n's text) onto runes
+func (n *node) appendRange(runes []rune, start int, end int) []rune {
+	if n == nil || start >= end {
+		return runes
+	}
+	leftSize := n.left.sizeOf()
+	if start < leftSize {
+		runes = n.left.appendRange(runes, start, end)
+	}
+	pieceStart := leftSize
+	pieceEnd := leftSize + n.piece.length
+	if start < pieceEnd && end > pieceStart {
+		from := start - pieceStart
+		if from < 0 {
+			from = 0
+		}
+		to := end - pieceStart
+		if to > n.piece.length {
+			to = n.piece.length
+		}
+		runes = append(runes, n.piece.source[n.piece.start+from:n.piece.start+to]...)
+	}
+	if end > pieceEnd {
+		runes = n.right.appendRange(runes, start-pieceEnd, end-pieceEnd)
+	}
+	return runes
+}
+
+// the node holding the last piece of the text
+func (n *node) last() *node {
+	if n == nil {
+		return nil
+	}
+	for n.right != nil {
+		n = n.right
+	}
+	return n
+}
+
+// a copy of tree n with its last piece made longer by length runes of source
+func (n *node) extendLast(source []rune, length int) *node {
+	if n.right != nil {
+		return n.with(n.left, n.right.extendLast(source, length))
+	}
+	pc := n.piece
+	pc.source = source
+	pc.length += length
+	return newNode(pc, n.priority, n.left, nil)
+}
+
+// Split tree n into the text before position and the text from position onward.  A piece that straddles
+//  position is cut in two.
+func split(n *node, position int) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+	leftSize := n.left.sizeOf()
+	if position <= leftSize {
+		left, right := split(n.left, position)
+		return left, n.with(right, n.right)
+	}
+	if position >= leftSize+n.piece.length {
+		left, right := split(n.right, position-leftSize-n.piece.length)
+		return n.with(n.left, left), right
+	}
+	// position falls within this node's piece
+	cut := position - leftSize
+	before := n.piece
+	before.length = cut
+	after := n.piece
+	after.start += cut
+	after.length -= cut
+	left := newNode(before, n.priority, n.left, nil)
+	right := newNode(after, n.priority, nil, n.right)
+	return left, right
+}
+
+// Join two trees (all of a's text comes before b's)
+func merge(a *node, b *node) *node {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		return a.with(a.left, merge(a.right, b))
+	}
+	return b.with(merge(a, b.left), b.right)
 }
@@ -2,9 +2,15 @@ package main
 
 import (
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 //go:embed gulliver.txt
@@ -143,3 +149,402 @@ func TestPieceTable(t *testing.T) {
 	}
 
 }
+
+func TestPieceTableTree(t *testing.T) {
+
+	fmt.Println("Deleted pieces are removed")
+	pt := NewPieceTable("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	pt.Insert(5, "FOO")
+	pt.Insert(10, "BAR")
+	pt.Delete(5, 3)
+	pt.Delete(7, 3)
+	if pt.Text() != "ABCDEFGHIJKLMNOPQRSTUVWXYZ" {
+		t.Errorf("Fail: wanted original text back, got >%s<\n", pt.Text())
+	}
+	if pt.pieceCount() != 3 {
+		t.Errorf("Fail: wanted 3 pieces after deletes, got %d\n", pt.pieceCount())
+	}
+	pt.Delete(0, pt.lastpos)
+	if pt.pieceCount() != 0 || pt.Text() != "" {
+		t.Errorf("Fail: wanted no pieces after deleting everything, got %d >%s<\n", pt.pieceCount(), pt.Text())
+	}
+
+	fmt.Println("Typing coalesces into a single piece")
+	pt = NewPieceTable("")
+	for _, r := range "hello world" {
+		pt.AppendRune(r)
+	}
+	if pt.pieceCount() != 1 {
+		t.Errorf("Fail: wanted 1 piece after typing, got %d\n", pt.pieceCount())
+	}
+
+	fmt.Println("Random edits match a plain rune slice")
+	rnd := rand.New(rand.NewSource(42))
+	pt = NewPieceTable(mediumtext[:2000])
+	answer := []rune(mediumtext[:2000])
+	for i := 0; i < 5000; i++ {
+		pos := rnd.Intn(len(answer) + 1)
+		if rnd.Intn(2) == 0 {
+			frag := []rune(fmt.Sprintf("<%d>", i))
+			pt.InsertRunes(pos, frag)
+			answer = append(answer[:pos], append(frag, answer[pos:]...)...)
+		} else if pos < len(answer) {
+			n := rnd.Intn(len(answer)-pos) % 10
+			pt.Delete(pos, n)
+			answer = append(answer[:pos], answer[pos+n:]...)
+		}
+		if pt.lastpos != len(answer) {
+			t.Fatalf("Fail: after edit %d length wanted %d got %d\n", i, len(answer), pt.lastpos)
+		}
+	}
+	if pt.Text() != string(answer) {
+		t.Errorf("Fail: random edits produced different text\n")
+	}
+}
+
+// Paste a huge note into the middle of some text, then edit all over it
+func BenchmarkPieceTableHugePaste(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		pt := NewPieceTable(mediumtext)
+		pt.Insert(pt.lastpos/2, bigtext)
+		for j := 0; j < 1000; j++ {
+			pos := (j * 7919) % pt.lastpos
+			pt.Insert(pos, "x")
+			pt.Delete(pos/2, 1)
+		}
+	}
+}
+
+// Lots of small scattered inserts make lots of pieces
+func BenchmarkPieceTableScatteredInserts(b *testing.B) {
+	pt := NewPieceTable(bigtext)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pos := (i * 7919) % pt.lastpos
+		pt.Insert(pos, "abc")
+	}
+}
+
+func TestPieceTableAccess(t *testing.T) {
+
+	pt := NewPieceTable("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	pt.Insert(5, "FOO")
+	pt.Insert(10, "BAR")
+	pt.Delete(20, 3)
+	pt.Insert(0, "123")
+	answer := []rune(pt.Text())
+
+	fmt.Println("Len and RuneAt")
+	if pt.Len() != len(answer) {
+		t.Errorf("Fail: Len wanted %d got %d\n", len(answer), pt.Len())
+	}
+	for i, r := range answer {
+		if pt.RuneAt(i) != r {
+			t.Errorf("Fail: RuneAt(%d) wanted %c got %c\n", i, r, pt.RuneAt(i))
+		}
+	}
+
+	fmt.Println("Slice")
+	for start := 0; start <= len(answer); start++ {
+		for end := start; end <= len(answer); end++ {
+			if result := string(pt.Slice(start, end)); result != string(answer[start:end]) {
+				t.Errorf("Fail: Slice(%d, %d) wanted >%s< got >%s<\n", start, end, string(answer[start:end]), result)
+			}
+		}
+	}
+
+	fmt.Println("Iterate forwards and backwards")
+	for start := 0; start <= len(answer); start++ {
+		it := pt.Iterator(start)
+		forward := []rune{}
+		for r, ok := it.Next(); ok; r, ok = it.Next() {
+			forward = append(forward, r)
+		}
+		if string(forward) != string(answer[start:]) {
+			t.Errorf("Fail: forward from %d wanted >%s< got >%s<\n", start, string(answer[start:]), string(forward))
+		}
+		backward := []rune{}
+		for r, ok := it.Prev(); ok; r, ok = it.Prev() {
+			backward = append([]rune{r}, backward...)
+		}
+		if string(backward) != string(answer) {
+			t.Errorf("Fail: backward from end wanted >%s< got >%s<\n", string(answer), string(backward))
+		}
+		it = pt.Iterator(start)
+		if r, ok := it.Prev(); start > 0 && (!ok || r != answer[start-1]) {
+			t.Errorf("Fail: Prev from %d wanted %c got %c\n", start, answer[start-1], r)
+		}
+		if r, ok := it.Next(); start > 0 && (!ok || r != answer[start-1] || it.Position() != start) {
+			t.Errorf("Fail: Next after Prev from %d wanted %c got %c\n", start, answer[start-1], r)
+		}
+	}
+
+	fmt.Println("Iterate an empty PieceTable")
+	it := NewPieceTable("").Iterator(0)
+	if _, ok := it.Next(); ok {
+		t.Errorf("Fail: Next on empty PieceTable should return false\n")
+	}
+	if _, ok := it.Prev(); ok {
+		t.Errorf("Fail: Prev on empty PieceTable should return false\n")
+	}
+}
+
+func TestPieceTableUndo(t *testing.T) {
+
+	base := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	fmt.Println("Undo and redo single edits")
+	pt := NewPieceTable(base)
+	pt.Insert(5, "FOO")
+	pt.Delete(0, 2)
+	states := []string{base, base[:5] + "FOO" + base[5:], base[2:5] + "FOO" + base[5:]}
+	for i := len(states) - 2; i >= 0; i-- {
+		if _, ok := pt.Undo(); !ok || pt.Text() != states[i] {
+			t.Errorf("Fail: Undo wanted >%s< got >%s<\n", states[i], pt.Text())
+		}
+	}
+	if _, ok := pt.Undo(); ok {
+		t.Errorf("Fail: Undo past the beginning of history succeeded\n")
+	}
+	for i := 1; i < len(states); i++ {
+		if _, ok := pt.Redo(); !ok || pt.Text() != states[i] {
+			t.Errorf("Fail: Redo wanted >%s< got >%s<\n", states[i], pt.Text())
+		}
+	}
+	if _, ok := pt.Redo(); ok {
+		t.Errorf("Fail: Redo past the end of history succeeded\n")
+	}
+
+	fmt.Println("Typed runes are one undo unit")
+	pt = NewPieceTable(base)
+	for i, r := range "hello" {
+		pt.InsertRunes(3+i, []rune{r})
+	}
+	pt.InsertRunes(0, []rune{'!'}) // typing somewhere else starts a new unit
+	pt.Undo()
+	if pt.Text() != base[:3]+"hello"+base[3:] {
+		t.Errorf("Fail: Undo of moved typing got >%s<\n", pt.Text())
+	}
+	if position, _ := pt.Undo(); pt.Text() != base || position != 3 {
+		t.Errorf("Fail: Undo of typing wanted >%s< at 3 got >%s< at %d\n", base, pt.Text(), position)
+	}
+
+	fmt.Println("Typing is undone a word at a time")
+	pt = NewPieceTable("")
+	for _, r := range "one two  three" {
+		pt.AppendRune(r)
+	}
+	for _, want := range []string{"one two  ", "one ", ""} {
+		if pt.Undo(); pt.Text() != want {
+			t.Errorf("Fail: Undo of a word wanted >%s< got >%s<\n", want, pt.Text())
+		}
+	}
+	pt = NewPieceTable("")
+	for i := 0; i < maxTypedRunes*2+5; i++ {
+		pt.AppendRune('x')
+	}
+	for _, want := range []int{maxTypedRunes * 2, maxTypedRunes, 0} {
+		if pt.Undo(); pt.Len() != want {
+			t.Errorf("Fail: Undo of a long word wanted %d runes left got %d\n", want, pt.Len())
+		}
+	}
+
+	fmt.Println("Groups are one undo unit")
+	pt = NewPieceTable(base)
+	pt.BeginGroup()
+	pt.Delete(0, 3)
+	pt.BeginGroup()
+	pt.Insert(0, "abc")
+	pt.EndGroup()
+	pt.Append("xyz")
+	pt.EndGroup()
+	pt.Undo()
+	if pt.Text() != base {
+		t.Errorf("Fail: Undo of group wanted >%s< got >%s<\n", base, pt.Text())
+	}
+	pt.Redo()
+	if pt.Text() != "abc"+base[3:]+"xyz" {
+		t.Errorf("Fail: Redo of group got >%s<\n", pt.Text())
+	}
+
+	fmt.Println("New edits discard redo")
+	pt.Undo()
+	pt.Insert(0, "Q")
+	if _, ok := pt.Redo(); ok || pt.Text() != "Q"+base {
+		t.Errorf("Fail: Redo after new edit got >%s<\n", pt.Text())
+	}
+
+	fmt.Println("History is limited")
+	pt = NewPieceTable("")
+	for i := 0; i < maxUndo+10; i++ {
+		pt.Insert(0, "ab")
+	}
+	undone := 0
+	for _, ok := pt.Undo(); ok; _, ok = pt.Undo() {
+		undone++
+	}
+	if undone != maxUndo || pt.Len() != 20 {
+		t.Errorf("Fail: wanted %d undos leaving 20 runes, got %d leaving %d\n", maxUndo, undone, pt.Len())
+	}
+}
+
+func TestPieceTableCompact(t *testing.T) {
+
+	base := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	fmt.Println("Compact keeps the text in a single piece")
+	pt := NewPieceTable(base)
+	pt.Insert(5, "FOO")
+	pt.Delete(0, 2)
+	pt.Insert(10, "a \"quoted\"\nline")
+	answer := pt.Text()
+	marshalled, _ := pt.MarshalJSON()
+	pt.Compact()
+	if pt.Text() != answer || pt.pieceCount() != 1 || len(pt.add) != 0 {
+		t.Errorf("Fail: Compact wanted >%s< in 1 piece got >%s< in %d pieces (add %d)\n", answer, pt.Text(), pt.pieceCount(), len(pt.add))
+	}
+	if compacted, _ := pt.MarshalJSON(); string(compacted) != string(marshalled) {
+		t.Errorf("Fail: MarshalJSON changed after Compact, wanted %s got %s\n", marshalled, compacted)
+	}
+
+	fmt.Println("Undo still works after Compact")
+	pt.Undo()
+	pt.Undo()
+	if pt.Text() != base[:5]+"FOO"+base[5:] {
+		t.Errorf("Fail: Undo after Compact got >%s<\n", pt.Text())
+	}
+	pt.InsertRunes(8, []rune{'!'}) // lands at the end of the old "FOO" piece, which must not be extended
+	pt.InsertRunes(9, []rune{'?'})
+	if answer = base[:5] + "FOO!?" + base[5:]; pt.Text() != answer {
+		t.Errorf("Fail: typing after Compact wanted >%s< got >%s<\n", answer, pt.Text())
+	}
+
+	fmt.Println("Fragmented text is compacted automatically")
+	pt = NewPieceTable(base)
+	for i := 0; i < compactPieces*2; i++ {
+		pt.Insert(i%pt.Len(), "x")
+	}
+	if pt.pieceCount() >= compactPieces {
+		t.Errorf("Fail: wanted fewer than %d pieces got %d\n", compactPieces, pt.pieceCount())
+	}
+	pt = NewPieceTable("")
+	for i := 0; i < compactMinAdd; i++ {
+		pt.Append("ab")
+		pt.Delete(0, 2)
+	}
+	if len(pt.add) >= compactMinAdd {
+		t.Errorf("Fail: wanted add buffer compacted got %d runes\n", len(pt.add))
+	}
+
+	fmt.Println("Compact frees deleted text the undo history no longer needs")
+	pt = NewPieceTable(base)
+	pt.Insert(0, strings.Repeat("x", 100000))
+	pt.Delete(0, 100000)
+	for i := 0; i < maxUndo; i++ { // long enough ago that it can't be undone any more
+		pt.Insert(i, "ab")
+	}
+	pt.Redo() // (nothing to redo, but the redo stack is rebased too)
+	answer = pt.Text()
+	pt.Compact()
+	if retained := retainedRunes(pt); pt.Text() != answer || retained > 3*len(answer) {
+		t.Errorf("Fail: wanted no more than %d runes kept after Compact got %d\n", 3*len(answer), retained)
+	}
+	for i := 0; i < maxUndo; i++ {
+		pt.Undo()
+	}
+	if pt.Text() != base {
+		t.Errorf("Fail: Undo after rebasing the history wanted >%s< got >%s<\n", base, pt.Text())
+	}
+	pt.Redo()
+	if pt.Text() != "ab"+base {
+		t.Errorf("Fail: Redo after rebasing the history got >%s<\n", pt.Text())
+	}
+}
+
+// how many runes are held by the buffers that the text and its undo history use
+func retainedRunes(pt *PieceTable) int {
+	buffers := make(map[*rune]int)
+	count := func(n *node) {
+		n.walk(func(pc piece) { buffers[bufferKey(pc.source)] = cap(pc.source) })
+	}
+	count(pt.root)
+	for _, r := range pt.history.undo {
+		count(r.root)
+	}
+	for _, r := range pt.history.redo {
+		count(r.root)
+	}
+	total := 0
+	for _, c := range buffers {
+		total += c
+	}
+	return total
+}
+
+func TestPieceTableJSON(t *testing.T) {
+
+	fmt.Println("Awkward text round trips through JSON")
+	for _, text := range []string{"", "plain", "\"quotes\"", "back\\slash\\", "line\none\r\ntwo\ttab", "\x00\x01\x1f\x7f", "  ", "日本語 emoji 😀 é"} {
+		checkJSONRoundTrip(t, []rune(text))
+	}
+	checkJSONRoundTrip(t, []rune{'a', 0xd800, 'b', 0xdfff, 0x110000, -1}) // lone surrogates and invalid runes become U+FFFD
+
+	seed := int64(42) // set GV_TEST_SEED to try others
+	if env, err := strconv.ParseInt(os.Getenv("GV_TEST_SEED"), 10, 64); err == nil {
+		seed = env
+	}
+	fmt.Printf("Random runes round trip through JSON (seed %d)\n", seed)
+	rnd := rand.New(rand.NewSource(seed))
+	for i := 0; i < 500; i++ {
+		runes := make([]rune, rnd.Intn(40))
+		for j := range runes {
+			switch rnd.Intn(6) {
+			case 0:
+				runes[j] = rune(rnd.Intn(0x80)) // ASCII, including NUL and the other control characters
+			case 1:
+				runes[j] = rune(rnd.Intn(0x800))
+			case 2:
+				runes[j] = []rune{0, '\u2028', '\u2029', 0xd800 + rune(rnd.Intn(0x800))}[rnd.Intn(4)] // (0xd800 on are lone surrogates)
+			default:
+				runes[j] = rune(rnd.Intn(utf8.MaxRune + 1))
+			}
+		}
+		checkJSONRoundTrip(t, runes)
+	}
+
+	fmt.Println("null leaves a PieceTable unchanged")
+	pt := NewPieceTable("kept")
+	if err := json.Unmarshal([]byte(` null `), pt); err != nil || pt.Text() != "kept" {
+		t.Errorf("Fail: unmarshalling null got >%s< (%v)\n", pt.Text(), err)
+	}
+	var h Headline
+	if err := json.Unmarshal([]byte(`{"Buf": {"text": "x"}, "Note": null}`), &h); err != nil || h.Note != nil || h.Buf.Text() != "x" {
+		t.Errorf("Fail: a null Note wanted no Note got %v (%v)\n", h.Note, err)
+	}
+
+	fmt.Println("Unexpected JSON is an error")
+	for _, bad := range []string{`"text"`, `42`, `[]`, `{}`, `{"text": 7}`, `{"text": null}`, `{"text": ["a"]}`, `{"text": "unterminated}`} {
+		var pt PieceTable
+		if err := json.Unmarshal([]byte(bad), &pt); err == nil {
+			t.Errorf("Fail: no error unmarshalling %s\n", bad)
+		}
+	}
+}
+
+// Marshal runes (edited in pieces) and make sure they are valid JSON that unmarshals to the same text.  Runes
+//  that aren't valid (like lone surrogates) come back as U+FFFD.
+func checkJSONRoundTrip(t *testing.T, runes []rune) {
+	text := string(runes)
+	pt := NewPieceTable("")
+	pt.InsertRunes(0, runes[len(runes)/2:])
+	pt.InsertRunes(0, runes[:len(runes)/2])
+	buf, err := json.Marshal(pt)
+	if err != nil || !json.Valid(buf) {
+		t.Errorf("Fail: invalid JSON for %q: %s (%v)\n", text, buf, err)
+		return
+	}
+	var loaded PieceTable
+	if err := json.Unmarshal(buf, &loaded); err != nil || loaded.Text() != text {
+		t.Errorf("Fail: round trip of %q got %q (%v)\n", text, loaded.Text(), err)
+	}
+}
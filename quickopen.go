@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+Quick open (CTRL-P in the Editor or the Organizer) picks any outline, in any Folder, by typing a few characters of
+its title or of the names of the Folders it is in.  Recently opened outlines are listed first.
+
+*/
+
+// Every outline beneath the storage directory (as full paths) with items to pick them by
+func (org *organizer) allOutlines() ([]string, []pickerItem) {
+	type outline struct {
+		path  string
+		title string
+	}
+	var outlines []outline
+	filepath.Walk(org.directory, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil // skip anything we can't read
+		}
+		if fi.IsDir() && path != org.directory && strings.HasPrefix(fi.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), ".gv") {
+			if info, err := org.cache.infoFor(path, fi); err == nil {
+				outlines = append(outlines, outline{path, info.title()})
+			}
+		}
+		return nil
+	})
+	org.cache.save()
+	opened := make(map[string]int)
+	for i, path := range pathList(recentCfgKey) {
+		opened[path] = i + 1
+	}
+	sort.SliceStable(outlines, func(i, j int) bool {
+		a, b := opened[outlines[i].path], opened[outlines[j].path]
+		if a != b && (a == 0 || b == 0) {
+			return b == 0 // opened recently comes before never opened
+		}
+		if a != b {
+			return a < b
+		}
+		return outlines[i].title < outlines[j].title
+	})
+	paths := make([]string, len(outlines))
+	items := make([]pickerItem, len(outlines))
+	root := org.folderPath(org.directory)
+	for i, o := range outlines {
+		paths[i] = o.path
+		folder := "" // (the root Folder goes without saying)
+		if dir := filepath.Dir(o.path); filepath.Clean(dir) != filepath.Clean(org.directory) {
+			folder = strings.TrimPrefix(org.folderPath(dir), root+" / ")
+		}
+		items[i] = pickerItem{o.title, folder}
+	}
+	return paths, items
+}
+
+// Pick an outline and open it (saving the current one first, if need be).  Returns whether we opened one.
+func (e *editor) quickOpen(s tcell.Screen) bool {
+	paths, items := e.org.allOutlines()
+	i, _, _ := pick(s, "Open", items)
+	drawScreen(s)
+	if i == -1 {
+		return false
+	}
+	e.open(s, paths[i])
+	return e.filePath() == paths[i]
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+
+Statistics about the outline being edited, shown in the bottom border beneath the Editor: how many Headlines,
+laid out lines, words and characters it has, and where the cursor is (its Headline's depth, and which of the
+visible Headlines it is on).  While text is selected the words and characters in the selection are shown as well.
+
+The stats are shown after every keystroke, so they are kept as running totals.  Each Headline's counts are
+remembered along with the version of the text (and Note) they were counted from.  After an edit to the current
+Headline only it is counted again, and the totals are adjusted by the difference.  Headlines that are added or
+removed are added to or taken off the totals as it happens, so the outline is only added up from scratch when a
+different outline is opened.  The cursor's position and depth are worked out from the visible Headlines and the
+current Headline's ancestors.
+
+*/
+
+// how many words and characters are in a Headline's text and Note
+type headlineCounts struct {
+	textVersion uint64
+	noteVersion uint64 // 0 if there is no Note
+	words       int
+	chars       int
+}
+
+type outlineStats struct {
+	headlines int
+	lines     int // laid out (visible) lines
+	words     int
+	chars     int
+	level     int // depth of the cursor's Headline (1 for top level)
+	position  int // which of the visible Headlines the cursor is on (1 for the first)
+	selected  bool
+	selWords  int
+	selChars  int
+}
+
+// Words and characters (grapheme clusters) in text
+func countText(text string) (int, int) {
+	text = strings.TrimSuffix(text, emptyHeadlineText)
+	return len(strings.Fields(text)), len(clustersOf([]rune(text)))
+}
+
+// Running totals for the outline being edited
+type outlineTotals struct {
+	out       *Outline                      // the outline the totals belong to
+	counts    map[*Headline]*headlineCounts // how many words and characters each Headline has
+	headlines int
+	words     int
+	chars     int
+}
+
+// Count h again if its text or Note has changed, adjusting the totals by the difference
+func (t *outlineTotals) recount(h *Headline) {
+	if t.counts == nil {
+		return // the totals haven't been added up yet, they will be the first time they're needed
+	}
+	var noteVersion uint64
+	if h.Note != nil {
+		noteVersion = h.Note.Version()
+	}
+	c, found := t.counts[h]
+	if found && c.textVersion == h.Buf.Version() && c.noteVersion == noteVersion {
+		return
+	}
+	if found {
+		t.words -= c.words
+		t.chars -= c.chars
+	}
+	c = &headlineCounts{textVersion: h.Buf.Version(), noteVersion: noteVersion}
+	c.words, c.chars = countText(h.Buf.Text())
+	if h.Note != nil {
+		words, chars := countText(h.Note.Text())
+		c.words += words
+		c.chars += chars
+	}
+	t.counts[h] = c
+	t.words += c.words
+	t.chars += c.chars
+}
+
+// Add h and all of its children (which have just been added to the outline) to the totals
+func (t *outlineTotals) add(h *Headline) {
+	if t.counts == nil {
+		return
+	}
+	h.walk(1, func(h *Headline, level int) {
+		t.headlines++
+		t.recount(h)
+	})
+}
+
+// Take h (which has just been removed from the outline) off the totals.  Its children are taken off too, unless
+//  they were moved somewhere else first.
+func (t *outlineTotals) remove(h *Headline, children bool) {
+	c, found := t.counts[h]
+	if !found {
+		return
+	}
+	t.headlines--
+	t.words -= c.words
+	t.chars -= c.chars
+	delete(t.counts, h)
+	if children {
+		for _, child := range h.Children {
+			t.remove(child, true)
+		}
+	}
+}
+
+// Add up the totals for out from scratch
+func (t *outlineTotals) addUp(out *Outline) {
+	*t = outlineTotals{out: out, counts: make(map[*Headline]*headlineCounts)}
+	out.walk(func(h *Headline, level int) {
+		t.headlines++
+		t.recount(h)
+	})
+}
+
+// How deep h is in the outline (1 for top level)
+func (o *Outline) depth(h *Headline) int {
+	level := 1
+	for p := h.ParentID; p != -1; p = o.headlineIndex[p].ParentID {
+		level++
+	}
+	return level
+}
+
+// Work out the stats for the outline being edited (using the lines it was last laid out as)
+func (e *editor) stats() outlineStats {
+	t := &e.totals
+	if t.out != e.out {
+		t.addUp(e.out)
+	}
+	st := outlineStats{lines: len(e.lineIndex)}
+	if h := e.out.headlineIndex[e.currentHeadlineID]; h != nil {
+		t.recount(h) // only the current Headline can have been edited
+		st.level = e.out.depth(h)
+	}
+	if i, found := e.visibleIndex[e.currentHeadlineID]; found {
+		st.position = i + 1
+	}
+	st.headlines, st.words, st.chars = t.headlines, t.words, t.chars
+	if e.isSelecting() {
+		st.selected = true
+		st.selWords, st.selChars = countText(string(e.currentBuf().Slice(e.sel.startPosition, e.selectionEnd())))
+	}
+	return st
+}
+
+// The stats as shown in the bottom border.  Less important parts are left out until it fits within width.
+func (st outlineStats) text(width int) string {
+	var parts []string
+	if st.selected {
+		parts = append(parts, fmt.Sprintf("Selected %s, %s", plural(st.selWords, "word"), plural(st.selChars, "char")))
+	}
+	parts = append(parts,
+		fmt.Sprintf("Headline %d of %d", st.position, st.headlines),
+		fmt.Sprintf("Depth %d", st.level),
+		plural(st.words, "word"),
+		plural(st.chars, "char"),
+		plural(st.lines, "line"))
+	for len(parts) > 0 {
+		text := strings.Join(parts, " · ")
+		if len([]rune(text)) <= width {
+			return text
+		}
+		parts = parts[:len(parts)-1]
+	}
+	return ""
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+
+	fmt.Println("Count words and characters")
+	if words, chars := countText("Hello  wörld 👍🏽" + emptyHeadlineText); words != 3 || chars != 14 {
+		t.Errorf("Fail: wanted 3 words and 14 chars got %d and %d\n", words, chars)
+	}
+
+	fmt.Println("Outline stats")
+	o := newOutline("Stats")
+	one, _ := o.addHeadline("One two", -1)
+	two, _ := o.addHeadline("Three", one)
+	o.headlineIndex[two].Note = NewPieceTable("four five" + emptyHeadlineText)
+	o.addHeadline("Six", -1)
+	e := layoutEditor(o)
+	e.layoutOutline(nil)
+	e.currentHeadlineID = two
+	st := e.stats()
+	if st.headlines != 3 || st.words != 6 || st.chars != 24 || st.level != 2 || st.position != 2 || st.selected {
+		t.Errorf("Fail: wrong stats %+v\n", st)
+	}
+
+	fmt.Println("An edit to the current Headline adjusts the totals")
+	counted := e.totals.counts[o.headlineIndex[one]]
+	o.headlineIndex[two].Buf.Insert(0, "Zero ")
+	st = e.stats()
+	if st.words != 7 || e.totals.counts[o.headlineIndex[one]] != counted || e.totals.counts[o.headlineIndex[two]].words != 4 {
+		t.Errorf("Fail: wanted 7 words with One's counts reused got %+v\n", st)
+	}
+
+	fmt.Println("Headlines added and removed adjust the totals")
+	addedUp := func() outlineTotals {
+		var fresh outlineTotals
+		fresh.addUp(o)
+		return fresh
+	}
+	six := o.Headlines[1]
+	e.currentHeadlineID = six.ID
+	e.cutHeadline()
+	if st = e.stats(); st.headlines != 2 || st.words != 6 || e.totals.counts[six] != nil || e.totals.counts[o.headlineIndex[one]] != counted {
+		t.Errorf("Fail: wanted 2 Headlines with 6 words got %+v\n", st)
+	}
+	e.pasteHeadline()
+	e.currentPosition = 0
+	e.enterPressed(o)
+	if st, fresh := e.stats(), addedUp(); st.headlines != 4 || st.headlines != fresh.headlines || st.words != fresh.words || st.chars != fresh.chars {
+		t.Errorf("Fail: after paste and Enter wanted %d Headlines, %d words, %d chars got %+v\n", fresh.headlines, fresh.words, fresh.chars, st)
+	}
+	e.layoutOutline(nil)
+	e.scrollToCursor()
+	e.backspace(o)
+	if st, fresh := e.stats(), addedUp(); st.headlines != 3 || st.words != fresh.words || st.chars != fresh.chars {
+		t.Errorf("Fail: after joining wanted 3 Headlines, %d words, %d chars got %+v\n", fresh.words, fresh.chars, st)
+	}
+	e.layoutOutline(nil)
+	e.scrollToCursor()
+	e.deleteHeadline(o)
+	e.layoutOutline(nil)
+	if st = e.stats(); st.headlines != 2 || st.words != 6 || st.position != 2 || st.level != 2 {
+		t.Errorf("Fail: wanted 2 Headlines with 6 words got %+v\n", st)
+	}
+
+	fmt.Println("Selection stats")
+	e.sel = &selection{two, 0, 9}
+	if st = e.stats(); !st.selected || st.selWords != 2 || st.selChars != 10 {
+		t.Errorf("Fail: wanted 2 words, 10 chars selected got %+v\n", st)
+	}
+	if text := st.text(60); text != "Selected 2 words, 10 chars · Headline 2 of 2 · Depth 2" {
+		t.Errorf("Fail: wrong stats text >%s<\n", text)
+	}
+	if text := st.text(3); text != "" {
+		t.Errorf("Fail: stats shouldn't be shown without room got >%s<\n", text)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+Templates for new outlines.  A template is an ordinary outline kept in $GVHOME/templates.  When there are any
+templates, creating a new outline (CTRL-O in the Organizer) lets us pick one (or a blank outline) and the new
+outline starts as a copy of it.
+
+Placeholders within the template's Headlines and Notes are filled in as it is copied:
+
+	{{date}}   today's date (2021-03-14)
+	{{time}}   the time now (15:04)
+	{{title}}  the title of the new outline
+	{{user}}   the name of the user
+
+*/
+
+const templatesDirectory = "templates"
+
+// The templates (full paths, and their titles) in dir, sorted by title.  They are read directly rather than
+//  through the outline cache, which is only for outlines in the storage directory.
+func findTemplates(dir string) ([]string, []string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil // no templates
+	}
+	type template struct{ path, title string }
+	var templates []template
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() || !strings.HasSuffix(fi.Name(), ".gv") {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		if out, err := loadOutline(path); err == nil {
+			info := outlineInfo{Title: out.Title}
+			templates = append(templates, template{path, info.title()})
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].title < templates[j].title })
+	paths := make([]string, len(templates))
+	titles := make([]string, len(templates))
+	for i, t := range templates {
+		paths[i] = t.path
+		titles[i] = t.title
+	}
+	return paths, titles
+}
+
+// Let the user pick a template for a new outline titled title.  Returns the new outline (nil for a blank one),
+//  or false if the user gave up.
+func (e *editor) chooseTemplate(s tcell.Screen, title string) (*Outline, bool) {
+	paths, titles := findTemplates(filepath.Join(e.org.baseDir, templatesDirectory))
+	if len(paths) == 0 {
+		return nil, true
+	}
+	items := []pickerItem{{"Blank outline", ""}}
+	for _, t := range titles {
+		items = append(items, pickerItem{t, ""})
+	}
+	i, _, _ := pick(s, "Template", items)
+	drawScreen(s)
+	if i <= 0 {
+		return nil, i == 0
+	}
+	out, err := outlineFromTemplate(paths[i-1], templateValues(title))
+	if err != nil {
+		prompt(s, "Unable to use template; "+err.Error())
+		return nil, false
+	}
+	return out, true
+}
+
+// What each placeholder is replaced with
+func templateValues(title string) map[string]string {
+	now := time.Now()
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return map[string]string{
+		"date":  now.Format("2006-01-02"),
+		"time":  now.Format("15:04"),
+		"title": title,
+		"user":  name,
+	}
+}
+
+// A new outline copied from the template at path, with its placeholders filled in from values.  The new outline
+//  is titled values["title"] and gets its own UIDs.
+func outlineFromTemplate(path string, values map[string]string) (*Outline, error) {
+	out, err := loadOutline(path)
+	if err != nil {
+		return nil, err
+	}
+	out.migrate()
+	out.Title = values["title"]
+	out.walk(func(h *Headline, level int) {
+		h.UID = newUID()
+		h.Buf = *NewPieceTable(expandPlaceholders(h.Buf.Text(), values))
+		if h.Note != nil {
+			h.Note = NewPieceTable(expandPlaceholders(h.Note.Text(), values))
+		}
+	})
+	return out, nil
+}
+
+// Replace each {{name}} in text with values[name].  Placeholders we don't know are left alone.
+func expandPlaceholders(text string, values map[string]string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, "{{")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(text[start:], "}}")
+		if end == -1 {
+			break
+		}
+		end += start
+		name := strings.ToLower(strings.TrimSpace(text[start+2 : end]))
+		if value, found := values[name]; found {
+			b.WriteString(text[:start] + value)
+		} else {
+			b.WriteString(text[:end+2])
+		}
+		text = text[end+2:]
+	}
+	return b.String() + text
+}
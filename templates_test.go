@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+
+	fmt.Println("Expand placeholders")
+	values := map[string]string{"date": "2021-03-14", "title": "Retro", "user": "sam"}
+	if text := expandPlaceholders("{{title}} on {{ Date }} by {{user}}, {{unknown}} {{", values); text != "Retro on 2021-03-14 by sam, {{unknown}} {{" {
+		t.Errorf("Fail: expanding placeholders got >%s<\n", text)
+	}
+
+	fmt.Println("Copy a template")
+	dir := t.TempDir()
+	template := newOutline("Meeting notes")
+	id, _ := template.addHeadline("{{title}} ({{date}})", -1)
+	child, _ := template.addHeadline("Attendees", id)
+	template.headlineIndex[child].Note = NewPieceTable("{{user}}" + emptyHeadlineText)
+	buf, _ := json.Marshal(template)
+	ioutil.WriteFile(filepath.Join(dir, "meeting.gv"), buf, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "readme.txt"), []byte("not a template"), 0644)
+	paths, titles := findTemplates(dir)
+	if len(paths) != 1 || titles[0] != "Meeting notes" {
+		t.Fatalf("Fail: wanted the Meeting notes template got %v %v\n", paths, titles)
+	}
+	out, err := outlineFromTemplate(paths[0], values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := out.headlineIndex[id]
+	if out.Title != "Retro" || h.plainText() != "Retro (2021-03-14)" || out.headlineIndex[child].Note.Text() != "sam"+emptyHeadlineText {
+		t.Errorf("Fail: wanted Retro (2021-03-14) with a Note from sam got %s: %s\n", out.Title, h.plainText())
+	}
+	if h.UID == template.headlineIndex[id].UID {
+		t.Errorf("Fail: a new outline should get new UIDs\n")
+	}
+	if paths, _ := findTemplates(filepath.Join(dir, "none")); paths != nil {
+		t.Errorf("Fail: wanted no templates got %v\n", paths)
+	}
+}
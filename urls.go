@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+/*
+
+URLs within Headline (and Note) text.  Anything starting with one of the urlSchemes is drawn like a link and can be
+opened with CTRL-U.  If gv.conf has a linkOpener (e.g. "xdg-open" or "open") we run it with the URL, otherwise
+the URL is copied to the clipboard.
+
+Terminals that understand OSC 8 hyperlinks also get told where each URL is on the screen so it can be clicked.
+
+*/
+
+const linkOpenerCfgKey = "linkOpener"
+const hyperlinksCfgKey = "hyperlinks" // set to "false" to stop emitting OSC 8 hyperlinks
+
+var urlSchemes = []string{"https://", "http://", "file://", "mailto:"}
+
+// a URL found within some text
+type webLink struct {
+	start   int // position of the first rune of the URL
+	end     int // position just after the URL
+	address string
+}
+
+// Find all of the URLs within the text of buf.  A URL runs until whitespace (or a control character), minus any
+//  punctuation at the end (so a URL at the end of a sentence, or in parentheses, doesn't take the punctuation
+//  with it).
+func findURLs(buf *PieceTable) []webLink {
+	var urls []webLink
+	var word []rune // the text since the last whitespace
+	wordStart := 0
+	it := buf.Iterator(0)
+	for {
+		r, ok := it.Next()
+		if ok && !unicode.IsSpace(r) && !unicode.IsControl(r) && r != nodeDelim {
+			word = append(word, r)
+			continue
+		}
+		urls = append(urls, urlsIn(word, wordStart)...)
+		if !ok {
+			return urls
+		}
+		word = word[:0]
+		wordStart = it.Position()
+	}
+}
+
+// Find the URLs within a word (without any whitespace or control characters) which starts at position offset
+func urlsIn(word []rune, offset int) []webLink {
+	var urls []webLink
+	for p := 0; p < len(word); p++ {
+		if p > 0 && (unicode.IsLetter(word[p-1]) || unicode.IsDigit(word[p-1])) {
+			continue // must start at the beginning of a word
+		}
+		if !hasScheme(word[p:]) {
+			continue
+		}
+		end := len(word)
+		for end > p && strings.ContainsRune(".,;:!?)]}>'\"*`~", word[end-1]) {
+			end--
+		}
+		address := string(word[p:end])
+		if !isSchemeOnly(address) {
+			urls = append(urls, webLink{offset + p, offset + end, address})
+		}
+		p = len(word)
+	}
+	return urls
+}
+
+func hasScheme(runes []rune) bool {
+	for _, scheme := range urlSchemes {
+		if len(runes) >= len(scheme) && strings.EqualFold(string(runes[:len(scheme)]), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSchemeOnly(address string) bool {
+	for _, scheme := range urlSchemes {
+		if strings.EqualFold(address, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the URL that includes position (if any)
+func urlAt(urls []webLink, position int) (webLink, bool) {
+	for _, u := range urls {
+		if position >= u.start && position < u.end {
+			return u, true
+		}
+	}
+	return webLink{}, false
+}
+
+// Open the URL beneath the cursor with the configured linkOpener, or copy it to the clipboard if there isn't one
+func (e *editor) openURL(s tcell.Screen) {
+	u, found := urlAt(findURLs(e.currentBuf()), e.currentPosition)
+	if !found {
+		return
+	}
+	opener := strings.Fields(cfg[linkOpenerCfgKey])
+	if len(opener) == 0 {
+		if err := copyToClipboard(u.address); err != nil {
+			prompt(s, fmt.Sprintf("Unable to copy %s to clipboard; %v", u.address, err))
+		} else {
+			prompt(s, "No linkOpener configured, copied to clipboard")
+		}
+		return
+	}
+	cmd := exec.Command(opener[0], append(opener[1:], u.address)...)
+	if err := cmd.Start(); err != nil {
+		prompt(s, fmt.Sprintf("Unable to open %s; %v", u.address, err))
+		return
+	}
+	go cmd.Wait() // don't leave a zombie behind
+}
+
+// a run of screen cells showing (part of) a URL
+type hyperlink struct {
+	x, y    int
+	text    []rune
+	width   int // how many cells the text takes up
+	address string
+	style   tcell.Style
+}
+
+// Remember that the cluster drawn at (x, y) is part of a URL, extending the previous run if we can
+func addHyperlink(links []hyperlink, x int, y int, cluster []rune, address string, style tcell.Style) []hyperlink {
+	if n := len(links); n > 0 {
+		last := &links[n-1]
+		if last.y == y && last.address == address && last.style == style && last.x+last.width == x {
+			last.text = append(last.text, cluster...)
+			last.width += clusterWidth(cluster)
+			return links
+		}
+	}
+	return append(links, hyperlink{x, y, append([]rune{}, cluster...), clusterWidth(cluster), address, style})
+}
+
+// Redraw each hyperlink wrapped in OSC 8 sequences.  tcell doesn't know about OSC 8, so this has to happen
+//  after the screen is shown.  We save and restore the cursor (which also restores the text attributes tcell
+//  expects) around each one.  Control characters are left out so that text from an outline can never end the
+//  sequence early and send escape sequences of its own to the terminal.
+func showHyperlinks(s tcell.Screen, links []hyperlink) {
+	if _, simulated := s.(tcell.SimulationScreen); simulated || len(links) == 0 || cfg[hyperlinksCfgKey] == "false" {
+		return
+	}
+	var b strings.Builder
+	for _, l := range links {
+		fmt.Fprintf(&b, "\x1b7\x1b[%d;%dH\x1b]8;;%s\x1b\\%s%s\x1b]8;;\x1b\\\x1b8", l.y+1, l.x+1,
+			withoutControls(l.address), sgr(l.style), withoutControls(string(l.text)))
+	}
+	writeTerminal(b.String())
+}
+
+// text with any control characters (ESC, BEL and so on) removed
+func withoutControls(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// the SGR escape sequence that draws text in style
+func sgr(style tcell.Style) string {
+	fg, bg, attrs := style.Decompose()
+	seq := "\x1b[0"
+	if attrs&tcell.AttrUnderline != 0 {
+		seq += ";4"
+	}
+	if attrs&tcell.AttrBold != 0 {
+		seq += ";1"
+	}
+	if attrs&tcell.AttrItalic != 0 {
+		seq += ";3"
+	}
+	if attrs&tcell.AttrStrikeThrough != 0 {
+		seq += ";9"
+	}
+	return seq + sgrColor(38, fg) + sgrColor(48, bg) + "m"
+}
+
+func sgrColor(kind int, c tcell.Color) string {
+	switch {
+	case c == tcell.ColorDefault:
+		return ""
+	case c&tcell.ColorIsRGB == 0 && c >= tcell.ColorValid && c < tcell.ColorValid+256: // a palette color
+		return fmt.Sprintf(";%d;5;%d", kind, c-tcell.ColorValid)
+	default:
+		r, g, b := c.RGB()
+		return fmt.Sprintf(";%d;2;%d;%d;%d", kind, r, g, b)
+	}
+}
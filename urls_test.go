@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestURLs(t *testing.T) {
+
+	fmt.Println("Find URLs in text")
+	urls := findURLs(NewPieceTable("see https://example.com/a?b=c, (http://x.org) mailto:me@here.com. xhttps://no file:///tmp/f https://" + emptyHeadlineText))
+	wanted := []string{"https://example.com/a?b=c", "http://x.org", "mailto:me@here.com", "file:///tmp/f"}
+	if len(urls) != len(wanted) {
+		t.Fatalf("Fail: wanted %v got %v\n", wanted, urls)
+	}
+	for i, u := range urls {
+		if u.address != wanted[i] {
+			t.Errorf("Fail: URL %d wanted %s got %s\n", i, wanted[i], u.address)
+		}
+	}
+	if urls[0].start != 4 || urls[0].end != 29 {
+		t.Errorf("Fail: first URL wanted 4-29 got %d-%d\n", urls[0].start, urls[0].end)
+	}
+	if u, found := urlAt(urls, 10); !found || u.address != wanted[0] {
+		t.Errorf("Fail: URL at 10 wanted %s got %v\n", wanted[0], u)
+	}
+	if _, found := urlAt(urls, 29); found {
+		t.Errorf("Fail: trailing comma should not be part of the URL\n")
+	}
+
+	fmt.Println("URLs end at control characters")
+	urls = findURLs(NewPieceTable("see https://x.example/\x1b]52;c;aGk=\x07 ok"))
+	if len(urls) != 1 || urls[0].address != "https://x.example/" {
+		t.Errorf("Fail: wanted just https://x.example/ got %v\n", urls)
+	}
+	if text := withoutControls("a\x1b]52;c;aGk=\x07b\u009c"); text != "a]52;c;aGk=b" {
+		t.Errorf("Fail: control characters left in %q\n", text)
+	}
+
+	fmt.Println("Hyperlink runs")
+	var links []hyperlink
+	for x, r := range "abc" {
+		links = addHyperlink(links, 10+x, 1, []rune{r}, "https://a", defStyle)
+	}
+	links = addHyperlink(links, 0, 2, []rune{'d'}, "https://a", defStyle)
+	if len(links) != 2 || string(links[0].text) != "abc" || links[0].width != 3 {
+		t.Errorf("Fail: wanted runs abc and d got %v\n", links)
+	}
+
+	fmt.Println("SGR sequences")
+	style := tcell.StyleDefault.Foreground(tcell.ColorBlue).Background(tcell.NewRGBColor(1, 2, 3)).Underline(true)
+	if seq := sgr(style); seq != "\x1b[0;4;38;5;12;48;2;1;2;3m" {
+		t.Errorf("Fail: SGR for %v got %q\n", style, seq)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	crand "crypto/rand"
 	"fmt"
 	"math/rand"
 	"regexp"
@@ -36,3 +37,25 @@ func randSeq(n int) string {
 	}
 	return string(b)
 }
+
+// v, but no less than low and no more than high
+func clamp(v int, low int, high int) int {
+	if v > high {
+		v = high
+	}
+	if v < low {
+		v = low
+	}
+	return v
+}
+
+// generate a random (version 4) UUID to use as a globally unique identifier
+func newUID() string {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		panic(err) // we cannot safely create Headlines without a source of randomness
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}